@@ -0,0 +1,301 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go3/env"
+	"go3/logging"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	accessLogCombined = "combined"
+	accessLogJSON     = "json"
+	accessLogOff      = "off"
+)
+
+// health checks hit the server every few seconds and drown out real traffic
+var healthPaths = []string{"/healthz", "/readyz"}
+
+// accessLogger writes one line per request, nil when ACCESS_LOG_FORMAT=off
+type accessLogger struct {
+	mu      sync.Mutex
+	out     io.Writer
+	format  string
+	exclude []string
+	samples []pathSample
+}
+
+// requests under prefix are logged with probability rate
+type pathSample struct {
+	prefix string
+	rate   float64
+}
+
+var accessLog *accessLogger
+
+// ACCESS_LOG_FORMAT combined (default), json or off
+// ACCESS_LOG_FILE writes to a file rotated at ACCESS_LOG_MAX_MB keeping ACCESS_LOG_KEEP old ones, stdout when unset
+// ACCESS_LOG_EXCLUDE and ACCESS_LOG_SAMPLE take comma separated path prefixes, the latter as prefix=rate (e.g. /v2/get_random=0.1)
+// health checks are left out unless ACCESS_LOG_HEALTH=TRUE
+func newAccessLogger() (*accessLogger, error) {
+	format := strings.ToLower(env.AccessLogFormat.Get())
+	if format == "" {
+		format = accessLogCombined
+	}
+	if format == accessLogOff {
+		return nil, nil
+	}
+	if format != accessLogCombined && format != accessLogJSON {
+		return nil, fmt.Errorf("ACCESS_LOG_FORMAT must be one of combined, json, off")
+	}
+	samples, err := parseSamples(env.AccessLogSample.Get())
+	if err != nil {
+		return nil, err
+	}
+	a := &accessLogger{out: os.Stdout, format: format, samples: samples, exclude: splitList(env.AccessLogExclude.Get())}
+	if env.AccessLogHealth.Get() != "TRUE" {
+		a.exclude = append(a.exclude, healthPaths...)
+	}
+	if path := env.AccessLogFile.Get(); path != "" {
+		file, err := openRotatingFile(path, int64(env.AccessLogMaxMB.Int(100))<<20, env.AccessLogKeep.Int(5))
+		if err != nil {
+			return nil, err
+		}
+		a.out = file
+	}
+	return a, nil
+}
+
+func splitList(raw string) []string {
+	var list []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func parseSamples(raw string) ([]pathSample, error) {
+	var samples []pathSample
+	for _, item := range splitList(raw) {
+		prefix, rawRate, ok := strings.Cut(item, "=")
+		rate, err := strconv.ParseFloat(rawRate, 64)
+		if !ok || err != nil || rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("invalid ACCESS_LOG_SAMPLE entry %q, want prefix=rate with rate between 0 and 1", item)
+		}
+		samples = append(samples, pathSample{prefix: prefix, rate: rate})
+	}
+	// the longest matching prefix decides
+	sort.Slice(samples, func(i, j int) bool { return len(samples[i].prefix) > len(samples[j].prefix) })
+	return samples, nil
+}
+
+// server errors are always logged, whatever the sampling says
+func (a *accessLogger) wants(path string, status int) bool {
+	for _, prefix := range a.exclude {
+		if strings.HasPrefix(path, prefix) {
+			return false
+		}
+	}
+	if status >= http.StatusInternalServerError {
+		return true
+	}
+	for _, s := range a.samples {
+		if strings.HasPrefix(path, s.prefix) {
+			return rand.Float64() < s.rate
+		}
+	}
+	return true
+}
+
+func (a *accessLogger) Wrap(next http.Handler) http.Handler {
+	if a == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		if a.wants(r.URL.Path, rec.status) {
+			a.write(r, rec, start)
+		}
+	})
+}
+
+type accessEntry struct {
+	Time      string  `json:"time"`
+	IP        string  `json:"ip"`
+	Method    string  `json:"method"`
+	Path      string  `json:"path"`
+	Query     string  `json:"query,omitempty"`
+	Proto     string  `json:"proto"`
+	Status    int     `json:"status"`
+	Bytes     int64   `json:"bytes"`
+	Duration  float64 `json:"duration_ms"`
+	RequestID string  `json:"request_id,omitempty"`
+	Referer   string  `json:"referer,omitempty"`
+	UserAgent string  `json:"user_agent,omitempty"`
+}
+
+func (a *accessLogger) write(r *http.Request, rec *statusRecorder, start time.Time) {
+	elapsed := time.Since(start)
+	var line []byte
+	if a.format == accessLogJSON {
+		line, _ = json.Marshal(accessEntry{
+			Time:      start.UTC().Format(time.RFC3339Nano),
+			IP:        clientIP(r),
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			Query:     r.URL.RawQuery,
+			Proto:     r.Proto,
+			Status:    rec.status,
+			Bytes:     rec.bytes,
+			Duration:  float64(elapsed.Microseconds()) / 1000,
+			RequestID: logging.RequestID(r.Context()),
+			Referer:   r.Referer(),
+			UserAgent: r.UserAgent(),
+		})
+	} else {
+		line = []byte(combinedLine(r, rec, start, elapsed))
+	}
+	line = append(line, '\n')
+
+	a.mu.Lock()
+	a.out.Write(line)
+	a.mu.Unlock()
+}
+
+// Combined Log Format followed by the request id and the duration in seconds
+// 203.0.113.7 - - [02/Jan/2006:15:04:05 +0000] "GET /v2/videos HTTP/1.1" 200 512 "-" "curl/8.0" "3f2a9c0d1b7e4a55" 0.004
+func combinedLine(r *http.Request, rec *statusRecorder, start time.Time, elapsed time.Duration) string {
+	bytes := "-"
+	if rec.bytes > 0 {
+		bytes = strconv.FormatInt(rec.bytes, 10)
+	}
+	return fmt.Sprintf("%s - - [%s] %s %d %s %s %s %s %.3f",
+		clientIP(r),
+		start.Format("02/Jan/2006:15:04:05 -0700"),
+		quoteField(r.Method+" "+r.URL.RequestURI()+" "+r.Proto),
+		rec.status,
+		bytes,
+		quoteField(r.Referer()),
+		quoteField(r.UserAgent()),
+		quoteField(logging.RequestID(r.Context())),
+		elapsed.Seconds(),
+	)
+}
+
+// empty fields are "-" like in Apache logs, quotes and control characters are escaped
+func quoteField(s string) string {
+	if s == "" {
+		return `"-"`
+	}
+	return strconv.Quote(s)
+}
+
+// closes the log file, stdout stays open
+func (a *accessLogger) Close() error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if file, ok := a.out.(*rotatingFile); ok {
+		return file.Close()
+	}
+	return nil
+}
+
+// rotatingFile starts a new file once the current one would grow past maxBytes,
+// old ones are renamed with a timestamp suffix and the oldest beyond keep are removed
+type rotatingFile struct {
+	path     string
+	maxBytes int64
+	keep     int
+	file     *os.File
+	size     int64
+}
+
+func openRotatingFile(path string, maxBytes int64, keep int) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f := &rotatingFile{path: path, maxBytes: maxBytes, keep: keep}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+// callers serialize writes, the access logger holds its mutex
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	if f.maxBytes > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxBytes {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	// milliseconds so two rotations within a second don't overwrite each other
+	rotated := f.path + "." + time.Now().UTC().Format("20060102-150405.000")
+	if err := os.Rename(f.path, rotated); err != nil {
+		return err
+	}
+	f.prune()
+	return f.open()
+}
+
+// the timestamp suffix sorts oldest first; keep 0 keeps everything
+func (f *rotatingFile) prune() {
+	if f.keep <= 0 {
+		return
+	}
+	files, err := filepath.Glob(f.path + ".*")
+	if err != nil || len(files) <= f.keep {
+		return
+	}
+	sort.Strings(files)
+	for _, file := range files[:len(files)-f.keep] {
+		os.Remove(file)
+	}
+}
+
+func (f *rotatingFile) Close() error {
+	return f.file.Close()
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSamples(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    []pathSample
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"/v2=0.5", []pathSample{{"/v2", 0.5}}, false},
+		{"/v2=0.5, /v2/videos=0.1,/=1", []pathSample{{"/v2/videos", 0.1}, {"/v2", 0.5}, {"/", 1}}, false},
+		{"/healthz=0", []pathSample{{"/healthz", 0}}, false},
+		{"/v2", nil, true},
+		{"/v2=abc", nil, true},
+		{"/v2=1.5", nil, true},
+		{"/v2=-0.1", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseSamples(tt.raw)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSamples(%q) error = %v, wantErr %v", tt.raw, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseSamples(%q) = %v, want %v", tt.raw, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"crypto/subtle"
+	"go3/env"
+	"net/http"
+	"strings"
+)
+
+// guards admin endpoints with the ADMIN_TOKEN bearer token,
+// they answer 404 while no token is configured
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := env.AdminToken.Get()
+		if token == "" {
+			http.NotFound(w, r)
+			return
+		}
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			http.Error(w, getRandomErrorResponse(), http.StatusUnauthorized)
+			logReject(r, "unauthorized admin request", "ip", clientIP(r))
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"go3/db"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+type APIKeyListResponse struct {
+	Keys []db.APIKey `json:"keys"`
+}
+
+// the raw key is only ever part of this response
+type IssuedAPIKeyResponse struct {
+	db.APIKey
+	Key string `json:"key"`
+}
+
+func handleAdminAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := db.ListAPIKeys(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to list API keys", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(APIKeyListResponse{Keys: keys})
+}
+
+// optional note to remember who got the key
+func handleAdminIssueAPIKey(w http.ResponseWriter, r *http.Request) {
+	key, raw, err := db.IssueAPIKey(r.Context(), r.URL.Query().Get("note"), adminAudit(r))
+	if err != nil {
+		http.Error(w, "Failed to issue API key", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(IssuedAPIKeyResponse{APIKey: key, Key: raw})
+	slog.InfoContext(r.Context(), "admin: API key issued", "id", key.ID, "note", key.Note)
+}
+
+func handleAdminRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid API key id", http.StatusBadRequest)
+		return
+	}
+	err = db.RevokeAPIKey(r.Context(), id, adminAudit(r))
+	if err == sql.ErrNoRows {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to revoke API key", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+	slog.InfoContext(r.Context(), "admin: API key revoked", "id", id)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"go3/db"
+	"go3/logging"
+	"net/http"
+	"net/url"
+)
+
+// changes made from a public endpoint are attributed to the client identity
+func requestAudit(r *http.Request) db.Audit {
+	return db.Audit{Actor: clientIdentity(r), RequestID: logging.RequestID(r.Context())}
+}
+
+// everyone shares ADMIN_TOKEN, the client identity tells admins apart
+func adminAudit(r *http.Request) db.Audit {
+	return db.Audit{Actor: "admin:" + clientIdentity(r), RequestID: logging.RequestID(r.Context())}
+}
+
+// one request id per run so a mass --update can be found as a whole
+func cliAudit() db.Audit {
+	return db.Audit{Actor: db.ActorCLI, RequestID: logging.NewRequestID()}
+}
+
+type AuditListResponse struct {
+	Entries []db.AuditEntry `json:"entries"`
+	Offset  int             `json:"offset"`
+}
+
+// optional filters: actor, action, target (a video id, ban:<id>, blocklist:<id> or apikey:<id>)
+func handleAdminAudit(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parseLimitOffset(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	entries, err := db.ListAudit(r.Context(), auditQuery(r.URL.Query(), limit, offset))
+	if err != nil {
+		http.Error(w, "Failed to list audit log", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AuditListResponse{Entries: entries, Offset: offset})
+}
+
+func auditQuery(params url.Values, limit int, offset int) db.AuditQuery {
+	return db.AuditQuery{
+		Actor:  params.Get("actor"),
+		Action: params.Get("action"),
+		Target: params.Get("target"),
+		Limit:  limit,
+		Offset: offset,
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go3/db"
+	"go3/env"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const backupTimeFormat = "20060102-150405"
+
+var (
+	errBackupsDisabled = errors.New("BACKUP_DIR is not set")
+	backupMu           sync.Mutex
+)
+
+// name of the backup files next to each other in BACKUP_DIR, e.g. videos-20250101-120000.db
+func backupPrefix() string {
+	base := filepath.Base(env.DBPath.Get())
+	return strings.TrimSuffix(base, filepath.Ext(base)) + "-"
+}
+
+// writes a timestamped backup to BACKUP_DIR and drops the oldest beyond BACKUP_KEEP
+func backupToDir() (string, error) {
+	dir := env.BackupDir.Get()
+	if dir == "" {
+		return "", errBackupsDisabled
+	}
+	backupMu.Lock()
+	defer backupMu.Unlock()
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, backupPrefix()+time.Now().UTC().Format(backupTimeFormat)+".db")
+	if err := db.Backup(path); err != nil {
+		return "", err
+	}
+	rotateBackups(dir, env.BackupKeep.Int(7))
+	return path, nil
+}
+
+// the timestamp in the name sorts oldest first; keep 0 keeps everything
+func rotateBackups(dir string, keep int) {
+	if keep <= 0 {
+		return
+	}
+	files, err := filepath.Glob(filepath.Join(dir, backupPrefix()+"*.db"))
+	if err != nil || len(files) <= keep {
+		return
+	}
+	sort.Strings(files)
+	for _, file := range files[:len(files)-keep] {
+		if err := os.Remove(file); err != nil {
+			slog.Error("error removing old backup", "err", err)
+			continue
+		}
+		slog.Info("removed old backup", "file", file)
+	}
+}
+
+// backs up every BACKUP_INTERVAL_HOURS, 0 turns scheduled backups off
+func runBackups(ctx context.Context) {
+	hours := env.BackupInterval.Int(0)
+	if hours <= 0 || env.BackupDir.Get() == "" {
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Duration(hours) * time.Hour):
+		}
+		if _, err := backupToDir(); err != nil {
+			slog.Error("error running scheduled backup", "err", err)
+		}
+	}
+}
+
+type BackupResponse struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+func handleAdminBackup(w http.ResponseWriter, r *http.Request) {
+	path, err := backupToDir()
+	if err == errBackupsDisabled {
+		http.Error(w, "Backups are not configured", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to back up database", http.StatusInternalServerError)
+		return
+	}
+	response := BackupResponse{Path: path}
+	if info, err := os.Stat(path); err == nil {
+		response.Size = info.Size()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+	slog.InfoContext(r.Context(), "admin: database backed up", "path", path)
+}
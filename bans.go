@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"go3/db"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// banCache keeps the ban list in memory so checking a request never hits the db,
+// admin changes reload it right away
+type banCache struct {
+	mu         sync.RWMutex
+	loaded     bool
+	identities map[string]db.Ban
+	networks   []cidrBan
+}
+
+type cidrBan struct {
+	network *net.IPNet
+	ban     db.Ban
+}
+
+var bans = &banCache{}
+
+func (c *banCache) Reload(ctx context.Context) error {
+	list, err := db.ListBans(ctx, false)
+	if err != nil {
+		return err
+	}
+	identities := make(map[string]db.Ban)
+	var networks []cidrBan
+	for _, ban := range list {
+		if ban.Kind == db.BanCIDR {
+			_, network, err := net.ParseCIDR(ban.Value)
+			if err != nil {
+				slog.WarnContext(ctx, "skipping invalid CIDR ban", "id", ban.ID, "value", ban.Value)
+				continue
+			}
+			networks = append(networks, cidrBan{network: network, ban: ban})
+			continue
+		}
+		identities[ban.Value] = ban
+	}
+
+	c.mu.Lock()
+	c.identities = identities
+	c.networks = networks
+	c.loaded = true
+	c.mu.Unlock()
+	slog.InfoContext(ctx, "loaded bans", "count", len(list))
+	return nil
+}
+
+// returns the ban matching the request, expired bans are skipped until the next reload drops them
+// the address is the peer unless it is a trusted proxy and a key only counts when it was issued,
+// so a client can't pick the identity that gets checked with a header
+func (c *banCache) Match(r *http.Request) (db.Ban, bool) {
+	c.mu.RLock()
+	loaded := c.loaded
+	c.mu.RUnlock()
+	if !loaded {
+		if err := c.Reload(r.Context()); err != nil {
+			slog.ErrorContext(r.Context(), "error loading bans", "err", err)
+		}
+	}
+
+	now := time.Now().Unix()
+	ip := clientIP(r)
+	ids := []string{db.HashIP(ip)}
+	if identity, ok := apiKeyIdentity(r); ok {
+		ids = append(ids, identity)
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, id := range ids {
+		if ban, ok := c.identities[id]; ok && ban.Active(now) {
+			return ban, true
+		}
+	}
+	if parsed := net.ParseIP(ip); parsed != nil {
+		for _, entry := range c.networks {
+			if entry.network.Contains(parsed) && entry.ban.Active(now) {
+				return entry.ban, true
+			}
+		}
+	}
+	return db.Ban{}, false
+}
+
+// rejects banned clients before the handler runs
+func rejectBanned(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ban, ok := bans.Match(r); ok {
+			http.Error(w, getRandomErrorResponse(), http.StatusForbidden)
+			logReject(r, "banned client", "ban", ban.ID)
+			return
+		}
+		next(w, r)
+	}
+}
+
+type BanListResponse struct {
+	Bans []db.Ban `json:"bans"`
+}
+
+func handleAdminBans(w http.ResponseWriter, r *http.Request) {
+	includeExpired := r.URL.Query().Get("expired") == "true"
+	list, err := db.ListBans(r.Context(), includeExpired)
+	if err != nil {
+		http.Error(w, "Failed to list bans", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(BanListResponse{Bans: list})
+}
+
+// kind=ip|cidr|key, value, optional reason and expires_in as a go duration (e.g. 72h)
+func handleAdminAddBan(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	var expiresAt int64
+	if raw := params.Get("expires_in"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			http.Error(w, "invalid 'expires_in' parameter", http.StatusBadRequest)
+			return
+		}
+		expiresAt = time.Now().Add(d).Unix()
+	}
+
+	ban, err := db.AddBan(r.Context(), params.Get("kind"), params.Get("value"), params.Get("reason"), expiresAt, adminAudit(r))
+	if err == db.ErrInvalidBan {
+		http.Error(w, "'kind' must be one of ip, cidr, key with a matching 'value'", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to save ban", http.StatusInternalServerError)
+		return
+	}
+	if err := bans.Reload(r.Context()); err != nil {
+		slog.ErrorContext(r.Context(), "error reloading bans", "err", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ban)
+	slog.InfoContext(r.Context(), "admin: ban added", "id", ban.ID, "kind", ban.Kind, "value", ban.Value)
+}
+
+func handleAdminDeleteBan(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid ban id", http.StatusBadRequest)
+		return
+	}
+	err = db.DeleteBan(r.Context(), id, adminAudit(r))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Ban not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to delete ban", http.StatusInternalServerError)
+		return
+	}
+	if err := bans.Reload(r.Context()); err != nil {
+		slog.ErrorContext(r.Context(), "error reloading bans", "err", err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+	slog.InfoContext(r.Context(), "admin: ban removed", "id", id)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"go3/db"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+// blocklistCache keeps blocked channels and compiled title patterns in memory,
+// admin changes reload it right away
+type blocklistCache struct {
+	mu       sync.RWMutex
+	loaded   bool
+	channels map[string]db.BlockEntry
+	titles   []titleBlock
+}
+
+type titleBlock struct {
+	pattern *regexp.Regexp
+	entry   db.BlockEntry
+}
+
+var blocklist = &blocklistCache{}
+
+func (c *blocklistCache) Reload(ctx context.Context) error {
+	list, err := db.ListBlockEntries(ctx)
+	if err != nil {
+		return err
+	}
+	channels := make(map[string]db.BlockEntry)
+	var titles []titleBlock
+	for _, entry := range list {
+		if entry.Kind == db.BlockTitle {
+			pattern, err := regexp.Compile(entry.Pattern)
+			if err != nil {
+				slog.WarnContext(ctx, "skipping invalid title pattern", "id", entry.ID, "pattern", entry.Pattern)
+				continue
+			}
+			titles = append(titles, titleBlock{pattern: pattern, entry: entry})
+			continue
+		}
+		channels[entry.Pattern] = entry
+	}
+
+	c.mu.Lock()
+	c.channels = channels
+	c.titles = titles
+	c.loaded = true
+	c.mu.Unlock()
+	slog.InfoContext(ctx, "loaded blocklist entries", "count", len(list))
+	return nil
+}
+
+// returns the entry blocking the video, if any
+func (c *blocklistCache) Match(ctx context.Context, video db.Video) (db.BlockEntry, bool) {
+	c.mu.RLock()
+	loaded := c.loaded
+	c.mu.RUnlock()
+	if !loaded {
+		if err := c.Reload(ctx); err != nil {
+			slog.ErrorContext(ctx, "error loading blocklist", "err", err)
+		}
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if entry, ok := c.channels[video.ChannelID]; ok && video.ChannelID != "" {
+		return entry, true
+	}
+	for _, title := range c.titles {
+		if title.pattern.MatchString(video.VideoName) {
+			return title.entry, true
+		}
+	}
+	return db.BlockEntry{}, false
+}
+
+// hides every stored video the blocklist matches, for entries added after the videos were
+func applyBlocklist(ctx context.Context, audit db.Audit) {
+	if err := blocklist.Reload(ctx); err != nil {
+		slog.ErrorContext(ctx, "error loading blocklist", "err", err)
+		return
+	}
+	videos, err := db.GetAllVideos(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "error getting videos", "err", err)
+		return
+	}
+	var ids []string
+	for _, video := range videos {
+		if entry, ok := blocklist.Match(ctx, video); ok && video.Status != db.StatusHidden {
+			slog.InfoContext(ctx, "video blocked", "id", video.ID, "entry", entry.ID, "kind", entry.Kind, "pattern", entry.Pattern)
+			ids = append(ids, video.ID)
+		}
+	}
+	hidden, err := db.HideVideos(ctx, ids, audit)
+	if err != nil {
+		slog.ErrorContext(ctx, "error hiding blocked videos", "err", err)
+		return
+	}
+	slog.InfoContext(ctx, "blocklist applied", "hidden", hidden)
+}
+
+type BlocklistResponse struct {
+	Entries []db.BlockEntry `json:"entries"`
+}
+
+func handleAdminBlocklist(w http.ResponseWriter, r *http.Request) {
+	list, err := db.ListBlockEntries(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to list blocklist", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(BlocklistResponse{Entries: list})
+}
+
+// kind=channel|title, pattern (a channel id or a regular expression), optional note
+func handleAdminAddBlockEntry(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	entry, err := db.AddBlockEntry(r.Context(), params.Get("kind"), params.Get("pattern"), params.Get("note"), adminAudit(r))
+	if err == db.ErrInvalidBlockEntry {
+		http.Error(w, "'kind' must be one of channel, title with a matching 'pattern'", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to save blocklist entry", http.StatusInternalServerError)
+		return
+	}
+	if err := blocklist.Reload(r.Context()); err != nil {
+		slog.ErrorContext(r.Context(), "error reloading blocklist", "err", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(entry)
+	slog.InfoContext(r.Context(), "admin: blocklist entry added", "id", entry.ID, "kind", entry.Kind, "pattern", entry.Pattern)
+}
+
+func handleAdminDeleteBlockEntry(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid blocklist entry id", http.StatusBadRequest)
+		return
+	}
+	err = db.DeleteBlockEntry(r.Context(), id, adminAudit(r))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Blocklist entry not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to delete blocklist entry", http.StatusInternalServerError)
+		return
+	}
+	if err := blocklist.Reload(r.Context()); err != nil {
+		slog.ErrorContext(r.Context(), "error reloading blocklist", "err", err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+	slog.InfoContext(r.Context(), "admin: blocklist entry removed", "id", id)
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"go3/db"
+	"go3/rng"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type ChannelListResponse struct {
+	Channels []db.Channel `json:"channels"`
+	Offset   int          `json:"offset"`
+}
+
+// logoFailures remembers channels whose logo could not be fetched,
+// they are not asked for again until the entry expires so a listing doesn't retry every channel on every request
+type logoFailures struct {
+	mu    sync.Mutex
+	until map[string]time.Time
+}
+
+const logoRetryAfter = 15 * time.Minute
+
+var logoMisses = &logoFailures{until: map[string]time.Time{}}
+
+func (f *logoFailures) failed(channelID string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	until, ok := f.until[channelID]
+	if ok && time.Now().After(until) {
+		delete(f.until, channelID)
+		return false
+	}
+	return ok
+}
+
+func (f *logoFailures) add(channelID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.until[channelID] = time.Now().Add(logoRetryAfter)
+}
+
+// returns the cached logo of the channel, it is fetched from YouTube and cached on first use
+func channelLogo(ctx context.Context, channelID string) string {
+	if channelID == "" {
+		return ""
+	}
+	channel, err := db.GetChannel(ctx, channelID)
+	hit := err == nil && channel.LogoURL != ""
+	cacheLookup("channel_logo", hit)
+	if hit {
+		return channel.LogoURL
+	}
+	return fetchChannelLogo(ctx, channelID)
+}
+
+// asks YouTube for the logo and caches it, channels that failed recently are not asked again
+func fetchChannelLogo(ctx context.Context, channelID string) string {
+	if logoMisses.failed(channelID) {
+		return ""
+	}
+	logo, err := fetchYTLogoLink(ctx, channelID)
+	if err != nil || logo == "" {
+		logoMisses.add(channelID)
+		if err != nil {
+			slog.ErrorContext(ctx, "error fetching logo", "err", err, "channel_id", channelID)
+		}
+		return ""
+	}
+	db.SetChannelLogo(ctx, channelID, logo)
+	return logo
+}
+
+// logoQueue fetches missing logos one at a time in the background,
+// a listing only queues its channels so a page never waits on YouTube
+type logoQueue struct {
+	mu     sync.Mutex
+	queued map[string]bool
+	ids    chan string
+}
+
+const logoQueueSize = 256
+
+var logoFetches = &logoQueue{queued: map[string]bool{}, ids: make(chan string, logoQueueSize)}
+
+// drops the channel when the queue is full, the next listing queues it again
+func (q *logoQueue) enqueue(channelID string) {
+	if channelID == "" || logoMisses.failed(channelID) {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.queued[channelID] {
+		return
+	}
+	select {
+	case q.ids <- channelID:
+		q.queued[channelID] = true
+	default:
+	}
+}
+
+func (q *logoQueue) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-q.ids:
+			fetchChannelLogo(ctx, id)
+			q.mu.Lock()
+			delete(q.queued, id)
+			q.mu.Unlock()
+		}
+	}
+}
+
+// looks up the channel from the path, writes the error response when it is missing
+func pathChannel(w http.ResponseWriter, r *http.Request) (db.Channel, bool) {
+	channel, err := db.GetChannel(r.Context(), r.PathValue("id"))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return channel, false
+	}
+	if err != nil {
+		http.Error(w, "Failed to get channel", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "error getting channel", "err", err)
+		return channel, false
+	}
+	return channel, true
+}
+
+func handleChannelList(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	sort := params.Get("sort")
+	if sort == "" {
+		sort = db.ChannelSortVideos
+	}
+	if sort != db.ChannelSortVideos && sort != db.ChannelSortTitle {
+		http.Error(w, "invalid 'sort' parameter", http.StatusBadRequest)
+		return
+	}
+	limit, offset, err := parseLimitOffset(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	channels, err := db.ListChannels(r.Context(), sort, limit, offset)
+	if err != nil {
+		http.Error(w, "Failed to list channels", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "error listing channels", "err", err)
+		return
+	}
+	for _, channel := range channels {
+		if channel.LogoURL == "" {
+			logoFetches.enqueue(channel.ID)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ChannelListResponse{Channels: channels, Offset: offset})
+}
+
+func handleChannelVideos(w http.ResponseWriter, r *http.Request) {
+	channel, ok := pathChannel(w, r)
+	if !ok {
+		return
+	}
+	q, err := parseListQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		logReject(r, err.Error(), "query", r.URL.RawQuery)
+		return
+	}
+	q.ChannelID = channel.ID
+
+	page, err := db.ListVideos(r.Context(), q)
+	if err != nil {
+		http.Error(w, "Failed to list videos", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "error listing videos", "err", err)
+		return
+	}
+	writeVideoPage(w, q, page)
+}
+
+func handleChannelRandom(w http.ResponseWriter, r *http.Request) {
+	channel, ok := pathChannel(w, r)
+	if !ok {
+		return
+	}
+	seed, err := parseSeed(r)
+	if err != nil {
+		http.Error(w, getRandomErrorResponse(), http.StatusBadRequest)
+		logReject(r, "invalid 'seed' parameter", "seed", r.URL.Query().Get("seed"))
+		return
+	}
+
+	video, err := db.GetRandomChannelVideo(r.Context(), rng.New(seed), channel.ID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Channel has no videos", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to get random video", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "error getting random video", "err", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	response := VideoResponse{
+		ID:              video.ID,
+		VideoName:       video.VideoName,
+		VideoAuthorName: video.VideoAuthorName,
+		IsEmbeddable:    video.IsEmbeddable,
+		LogoURL:         channelLogo(r.Context(), video.ChannelID),
+		Seed:            seed,
+		Votes:           videoVotes(r.Context(), video.ID),
+	}
+	json.NewEncoder(w).Encode(response)
+	stats.RecordImpression(video.ID)
+	slog.InfoContext(r.Context(), "requested random video of channel", "channel_id", channel.ID, "id", video.ID, "seed", seed)
+}
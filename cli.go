@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"go3/db"
+	"go3/logging"
+	"log/slog"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// subcommands, the first argument picks one; without one the binary serves like it always did
+const (
+	commandServe   = "serve"
+	commandList    = "list"
+	commandShow    = "show"
+	commandAdd     = "add"
+	commandDelete  = "delete"
+	commandStats   = "stats"
+	commandUpdate  = "update"
+	commandMigrate = "migrate"
+	commandHelp    = "help"
+)
+
+const usage = `usage: server [command] [flags] [<id>...]
+
+flags go before the ids
+
+commands:
+  serve              run the API server (default), maintenance flags run first
+  list               list saved videos
+  show <id>...       show videos with their votes and plays
+  add <id>...        fetch videos from YouTube and save them
+  delete <id>...     soft delete videos, restore with 'serve --undelete <id>'
+  stats              catalog size and plays over --days (default 7)
+  update [<id>...]   refresh videos from YouTube, all of them without ids
+                     --dry-run only prints what would change
+                     --fields limits what may change: title,author,embeddable,channel
+  migrate            import the ids from VIDEO_IDS_FILENAME
+  help               show this message
+
+output flags:
+  --output, -o       table (default) or json
+`
+
+// splits the subcommand off the arguments, flags alone mean serve
+func splitCommand(args []string) (string, []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return commandServe, args
+	}
+	return args[0], args[1:]
+}
+
+func isValidCommand(command string) bool {
+	switch command {
+	case commandServe, commandList, commandShow, commandAdd, commandDelete, commandStats, commandUpdate, commandMigrate, commandHelp:
+		return true
+	}
+	return false
+}
+
+// runs a command other than serve against an open database, returns the exit code
+func runCommand(command string, args config) int {
+	if args.Output != outputTable && args.Output != outputJSON {
+		fmt.Fprintln(os.Stderr, "--output must be one of table, json")
+		return 2
+	}
+	audit := cliAudit()
+	ctx := logging.WithRequestID(context.Background(), audit.RequestID)
+	switch command {
+	case commandList:
+		return listCommand(ctx, args)
+	case commandShow:
+		return showCommand(ctx, args)
+	case commandAdd:
+		return addCommand(ctx, args, audit)
+	case commandDelete:
+		return deleteCommand(ctx, args, audit)
+	case commandStats:
+		return statsCommand(ctx, args)
+	case commandUpdate:
+		opts, err := parseUpdateOptions(args)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		printDiffs(updateVideos(ctx, args.Args, opts, audit), args.Output)
+		return 0
+	case commandMigrate:
+		migrateDBfromJSON(ctx, audit)
+		return 0
+	}
+	fmt.Fprint(os.Stderr, usage)
+	return 2
+}
+
+// output modes
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+func printJSON(v any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func newTable() *tabwriter.Writer {
+	return tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+}
+
+func formatUnix(ts int64) string {
+	if ts == 0 {
+		return "-"
+	}
+	return time.Unix(ts, 0).UTC().Format("2006-01-02 15:04")
+}
+
+// ids are required by show, add and delete
+func requireIDs(command string, ids []string) bool {
+	if len(ids) == 0 {
+		fmt.Fprintf(os.Stderr, "usage: server %s <id>...\n", command)
+		return false
+	}
+	for _, id := range ids {
+		if !isValidID(id) {
+			fmt.Fprintf(os.Stderr, "invalid video id '%s'\n", id)
+			return false
+		}
+	}
+	return true
+}
+
+func listCommand(ctx context.Context, args config) int {
+	if args.Output == outputJSON {
+		if _, err := exportVideos(ctx, os.Stdout, formatJSON); err != nil {
+			slog.ErrorContext(ctx, "error listing videos", "err", err)
+			return 1
+		}
+		return 0
+	}
+
+	table := newTable()
+	fmt.Fprintln(table, "ID\tSTATUS\tADDED\tEMBED\tCHANNEL\tNAME")
+	err := db.EachVideo(ctx, func(video db.Video) error {
+		_, err := fmt.Fprintf(table, "%s\t%s\t%s\t%t\t%s\t%s\n",
+			video.ID, video.Status, formatUnix(video.AddedAt), video.IsEmbeddable, video.VideoAuthorName, video.VideoName)
+		return err
+	})
+	table.Flush()
+	if err != nil {
+		slog.ErrorContext(ctx, "error listing videos", "err", err)
+		return 1
+	}
+	return 0
+}
+
+type ShowResponse struct {
+	VideoDetailResponse
+	Plays db.StatCounts `json:"plays"`
+}
+
+func showCommand(ctx context.Context, args config) int {
+	if !requireIDs(commandShow, args.Args) {
+		return 2
+	}
+	code := 0
+	var shown []ShowResponse
+	for _, id := range args.Args {
+		video, err := db.GetVideo(ctx, id)
+		if err == sql.ErrNoRows {
+			fmt.Fprintf(os.Stderr, "%s: not found\n", id)
+			code = 1
+			continue
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "error getting video", "err", err)
+			return 1
+		}
+		response := ShowResponse{VideoDetailResponse: newVideoDetailResponse(video, "")}
+		votes := videoVotes(ctx, id)
+		response.Votes = &votes
+		days, err := db.GetVideoDailyStats(ctx, id, "")
+		if err != nil {
+			return 1
+		}
+		for _, day := range days {
+			response.Plays.Impressions += day.Impressions
+			response.Plays.Plays += day.Plays
+		}
+		shown = append(shown, response)
+	}
+
+	if args.Output == outputJSON {
+		printJSON(shown)
+		return code
+	}
+	for i, video := range shown {
+		if i > 0 {
+			fmt.Println()
+		}
+		table := newTable()
+		fmt.Fprintf(table, "id\t%s\n", video.ID)
+		fmt.Fprintf(table, "name\t%s\n", video.VideoName)
+		fmt.Fprintf(table, "channel\t%s (%s)\n", video.VideoAuthorName, video.ChannelID)
+		fmt.Fprintf(table, "status\t%s\n", video.Status)
+		fmt.Fprintf(table, "embeddable\t%t\n", video.IsEmbeddable)
+		fmt.Fprintf(table, "added\t%s\n", formatUnix(video.AddedAt))
+		fmt.Fprintf(table, "submitter\t%s\n", video.Submitter)
+		fmt.Fprintf(table, "votes\t+%d -%d (%d)\n", video.Votes.Likes, video.Votes.Dislikes, video.Votes.Score)
+		fmt.Fprintf(table, "plays\t%d of %d impressions\n", video.Plays.Plays, video.Plays.Impressions)
+		table.Flush()
+	}
+	return code
+}
+
+// fetches and saves one video the way /v2/add does, without the checks meant for the public
+func addVideo(ctx context.Context, id string, audit db.Audit) (db.Video, error) {
+	exists, err := db.IsVideoSaved(ctx, id)
+	if err != nil {
+		return db.Video{}, err
+	}
+	if exists {
+		return db.Video{}, fmt.Errorf("already saved")
+	}
+	deleted, err := db.IsVideoDeleted(ctx, id)
+	if err != nil {
+		return db.Video{}, err
+	}
+	if deleted {
+		return db.Video{}, fmt.Errorf("deleted, restore it with 'serve --undelete %s'", id)
+	}
+	ytResp, err := fetchYTVideoInfo(ctx, id)
+	if err != nil {
+		return db.Video{}, err
+	}
+	video := assembleVideo(ytResp, "", id)
+	video.Submitter = db.ActorCLI
+	if err := db.InsertVideo(ctx, video, audit); err != nil {
+		return db.Video{}, err
+	}
+	return video, nil
+}
+
+func addCommand(ctx context.Context, args config, audit db.Audit) int {
+	if !requireIDs(commandAdd, args.Args) {
+		return 2
+	}
+	code := 0
+	var added []VideoDetailResponse
+	for _, id := range args.Args {
+		video, err := addVideo(ctx, id, audit)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", id, err)
+			code = 1
+			continue
+		}
+		added = append(added, newVideoDetailResponse(video, ""))
+		if args.Output == outputTable {
+			fmt.Printf("%s: added '%s' by %s\n", id, video.VideoName, video.VideoAuthorName)
+		}
+	}
+	if args.Output == outputJSON {
+		printJSON(added)
+	}
+	return code
+}
+
+func deleteCommand(ctx context.Context, args config, audit db.Audit) int {
+	if !requireIDs(commandDelete, args.Args) {
+		return 2
+	}
+	code := 0
+	for _, id := range args.Args {
+		err := db.DeleteVideo(ctx, id, audit)
+		if err == sql.ErrNoRows {
+			fmt.Fprintf(os.Stderr, "%s: not found\n", id)
+			code = 1
+			continue
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "error deleting video", "err", err)
+			return 1
+		}
+		fmt.Printf("%s: deleted\n", id)
+	}
+	return code
+}
+
+type CatalogStatsResponse struct {
+	Videos   int            `json:"videos"`
+	ByStatus map[string]int `json:"by_status"`
+	StatsResponse
+}
+
+func statsCommand(ctx context.Context, args config) int {
+	if args.Days < 1 || args.Days > maxStatsDays {
+		fmt.Fprintf(os.Stderr, "--days must be between 1 and %d\n", maxStatsDays)
+		return 2
+	}
+	since := statsDay(time.Now().AddDate(0, 0, 1-args.Days))
+	byStatus, err := db.CountVideosByStatus(ctx)
+	if err != nil {
+		return 1
+	}
+	days, err := db.GetDailyStats(ctx, since)
+	if err != nil {
+		return 1
+	}
+	top, err := db.GetTopPlayed(ctx, since, 10)
+	if err != nil {
+		return 1
+	}
+	response := CatalogStatsResponse{ByStatus: byStatus, StatsResponse: StatsResponse{Days: days, Top: top}}
+	for _, count := range byStatus {
+		response.Videos += count
+	}
+
+	if args.Output == outputJSON {
+		printJSON(response)
+		return 0
+	}
+	table := newTable()
+	fmt.Fprintf(table, "videos\t%d\n", response.Videos)
+	for _, status := range []string{db.StatusActive, db.StatusReported, db.StatusHidden} {
+		fmt.Fprintf(table, "  %s\t%d\n", status, byStatus[status])
+	}
+	table.Flush()
+
+	fmt.Printf("\nlast %d days\n", args.Days)
+	table = newTable()
+	fmt.Fprintln(table, "DAY\tIMPRESSIONS\tPLAYS")
+	for _, day := range days {
+		fmt.Fprintf(table, "%s\t%d\t%d\n", day.Day, day.Impressions, day.Plays)
+	}
+	table.Flush()
+
+	fmt.Println("\nmost played")
+	table = newTable()
+	fmt.Fprintln(table, "ID\tIMPRESSIONS\tPLAYS")
+	for _, video := range top {
+		fmt.Fprintf(table, "%s\t%d\t%d\n", video.VideoID, video.Impressions, video.Plays)
+	}
+	table.Flush()
+	return 0
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"go3/db"
+	"go3/env"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const apiKeyHeader = "X-API-Key"
+
+// TRUSTED_PROXIES lists the addresses or CIDRs of the reverse proxies in front of the server
+var trustedProxies = sync.OnceValue(func() []*net.IPNet {
+	return parseTrustedProxies(env.TrustedProxies.Get())
+})
+
+// comma separated addresses or CIDRs, a bare address is a network of one
+func parseTrustedProxies(raw string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			slog.Warn("skipping invalid trusted proxy", "entry", entry)
+			continue
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+func isTrustedProxy(proxies []*net.IPNet, ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range proxies {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the address of the client, the peer address unless it is one of TRUSTED_PROXIES
+func clientIP(r *http.Request) string {
+	return resolveClientIP(r, trustedProxies())
+}
+
+// X-Forwarded-For is only believed from a trusted proxy and read from the right,
+// the first hop that isn't one of them is the client; without proxies the header is ignored
+func resolveClientIP(r *http.Request, proxies []*net.IPNet) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	prior := r.Header.Get("X-Forwarded-For")
+	if prior == "" || !isTrustedProxy(proxies, host) {
+		return host
+	}
+	hops := strings.Split(prior, ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop != "" && !isTrustedProxy(proxies, hop) {
+			return hop
+		}
+	}
+	return strings.TrimSpace(hops[0])
+}
+
+// the identity of the API key the request carries, only keys an admin issued count
+func apiKeyIdentity(r *http.Request) (string, bool) {
+	key := r.Header.Get(apiKeyHeader)
+	if key == "" {
+		return "", false
+	}
+	identity := db.HashAPIKey(key)
+	issued, err := db.IsAPIKeyIssued(r.Context(), identity)
+	if err != nil || !issued {
+		return "", false
+	}
+	return identity, true
+}
+
+// returns a stable hashed identity for the client: its API key when it was issued, its IP otherwise
+// a made up key falls back to the IP, so changing the header doesn't make a new voter
+func clientIdentity(r *http.Request) string {
+	if identity, ok := apiKeyIdentity(r); ok {
+		return identity
+	}
+	return db.HashIP(clientIP(r))
+}
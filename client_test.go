@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResolveClientIP(t *testing.T) {
+	proxies := parseTrustedProxies("10.0.0.0/8, 192.168.1.1, ::1")
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		proxies    string
+		want       string
+	}{
+		{"no header", "203.0.113.7:5000", "", "10.0.0.0/8", "203.0.113.7"},
+		{"header without proxies", "203.0.113.7:5000", "198.51.100.1", "", "203.0.113.7"},
+		{"header from untrusted peer", "203.0.113.7:5000", "198.51.100.1", "10.0.0.0/8", "203.0.113.7"},
+		{"header from trusted peer", "10.1.2.3:5000", "198.51.100.1", "10.0.0.0/8", "198.51.100.1"},
+		{"rightmost untrusted hop", "10.1.2.3:5000", "6.6.6.6, 198.51.100.1, 10.9.9.9", "10.0.0.0/8", "198.51.100.1"},
+		{"spoofed leftmost hop", "10.1.2.3:5000", "1.1.1.1,198.51.100.1", "10.0.0.0/8", "198.51.100.1"},
+		{"every hop trusted", "10.1.2.3:5000", "10.4.4.4, 10.5.5.5", "10.0.0.0/8", "10.4.4.4"},
+		{"bare proxy address", "192.168.1.1:5000", "198.51.100.1", "192.168.1.1", "198.51.100.1"},
+		{"ipv6 proxy", "[::1]:5000", "2001:db8::1", "::1", "2001:db8::1"},
+		{"remote without port", "203.0.113.7", "", "", "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if got := resolveClientIP(r, parseTrustedProxies(tt.proxies)); got != tt.want {
+				t.Errorf("resolveClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	for ip, want := range map[string]bool{"10.200.0.1": true, "192.168.1.1": true, "192.168.1.2": false, "::1": true, "not an ip": false} {
+		if got := isTrustedProxy(proxies, ip); got != want {
+			t.Errorf("isTrustedProxy(%q) = %v, want %v", ip, got, want)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+// APIKey is a key handed out by an admin, only its hashed identity is stored
+// so the raw key is shown once when it is issued
+type APIKey struct {
+	ID        int64  `json:"id"`
+	Identity  string `json:"identity"`
+	Note      string `json:"note"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+func apiKeyTarget(id int64) string {
+	return "apikey:" + strconv.FormatInt(id, 10)
+}
+
+// returns the stored key and the raw one to hand to the client
+func IssueAPIKey(ctx context.Context, note string, audit Audit) (APIKey, string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return APIKey{}, "", err
+	}
+	raw := hex.EncodeToString(b)
+
+	tx, err := DB.Begin()
+	if err != nil {
+		logError(ctx, "error starting transaction", err)
+		return APIKey{}, "", err
+	}
+	defer tx.Rollback()
+
+	key := APIKey{Identity: HashAPIKey(raw), Note: note, CreatedAt: time.Now().Unix()}
+	err = tx.QueryRow("INSERT INTO api_keys (identity, note, created_at) VALUES (?, ?, ?) RETURNING id", key.Identity, key.Note, key.CreatedAt).Scan(&key.ID)
+	if err != nil {
+		logError(ctx, "error saving API key", err)
+		return APIKey{}, "", err
+	}
+	if err := writeAudit(ctx, tx, audit, AuditAPIKeyAdd, apiKeyTarget(key.ID), nil, key); err != nil {
+		return APIKey{}, "", err
+	}
+	if err := tx.Commit(); err != nil {
+		logError(ctx, "error saving API key", err)
+		return APIKey{}, "", err
+	}
+	return key, raw, nil
+}
+
+const selectAPIKeys = "SELECT id, identity, note, created_at FROM api_keys"
+
+func scanAPIKey(row scanner, key *APIKey) error {
+	return row.Scan(&key.ID, &key.Identity, &key.Note, &key.CreatedAt)
+}
+
+// returns sql.ErrNoRows when there is no such key
+func RevokeAPIKey(ctx context.Context, id int64, audit Audit) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		logError(ctx, "error starting transaction", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	var key APIKey
+	if err := scanAPIKey(tx.QueryRow(selectAPIKeys+" WHERE id = ?", id), &key); err != nil {
+		if err != sql.ErrNoRows {
+			logError(ctx, "error getting API key", err)
+		}
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM api_keys WHERE id = ?", id); err != nil {
+		logError(ctx, "error revoking API key", err)
+		return err
+	}
+	if err := writeAudit(ctx, tx, audit, AuditAPIKeyDelete, apiKeyTarget(id), key, nil); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		logError(ctx, "error revoking API key", err)
+		return err
+	}
+	return nil
+}
+
+// lists issued keys newest first
+func ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	rows, err := DB.Query(selectAPIKeys + " ORDER BY id DESC")
+	if err != nil {
+		logError(ctx, "error listing API keys", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		var key APIKey
+		if err := scanAPIKey(rows, &key); err != nil {
+			logError(ctx, "error scanning row", err)
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// identity is the HashAPIKey of the key the client sent
+func IsAPIKeyIssued(ctx context.Context, identity string) (bool, error) {
+	var exists bool
+	err := DB.QueryRow("SELECT EXISTS(SELECT 1 FROM api_keys WHERE identity = ?)", identity).Scan(&exists)
+	if err != nil {
+		logError(ctx, "error checking API key", err)
+	}
+	return exists, err
+}
@@ -0,0 +1,142 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Audit says who made a change, every write that goes through db records it
+type Audit struct {
+	Actor     string
+	RequestID string
+}
+
+// actors for changes that don't come from a request
+const (
+	ActorCLI    = "cli"
+	ActorSystem = "system"
+)
+
+// audited actions
+const (
+	AuditVideoInsert     = "video.insert"
+	AuditVideoUpdate     = "video.update"
+	AuditVideoClear      = "video.clear"
+	AuditVideoDelete     = "video.delete"
+	AuditVideoRestore    = "video.restore"
+	AuditVideoPurge      = "video.purge"
+	AuditVideoImport     = "video.import"
+	AuditVideoStatus     = "video.status"
+	AuditVideoExpireIPs  = "video.expire_ips"
+	AuditReportAdd       = "report.add"
+	AuditReportResolve   = "report.resolve"
+	AuditVoteSet         = "vote.set"
+	AuditBanAdd          = "ban.add"
+	AuditBanDelete       = "ban.delete"
+	AuditBlocklistAdd    = "blocklist.add"
+	AuditBlocklistDelete = "blocklist.delete"
+	AuditAPIKeyAdd       = "apikey.add"
+	AuditAPIKeyDelete    = "apikey.delete"
+)
+
+type AuditEntry struct {
+	ID        int64           `json:"id"`
+	CreatedAt int64           `json:"created_at"`
+	Actor     string          `json:"actor"`
+	Action    string          `json:"action"`
+	Target    string          `json:"target"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	RequestID string          `json:"request_id,omitempty"`
+}
+
+// filters for ListAudit, empty fields match everything
+type AuditQuery struct {
+	Actor  string
+	Action string
+	Target string
+	Limit  int
+	Offset int
+}
+
+// nil snapshots are stored as NULL
+// video snapshots leave out added_from_ip so IP retention can't be undone from the log
+func auditSnapshot(v any) (sql.NullString, error) {
+	if v == nil {
+		return sql.NullString{}, nil
+	}
+	if video, ok := v.(Video); ok {
+		video.AddedFromIP = ""
+		v = video
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+// appends to the audit log inside the transaction making the change, so one never lands without the other
+func writeAudit(ctx context.Context, tx *sql.Tx, audit Audit, action string, target string, before any, after any) error {
+	beforeJSON, err := auditSnapshot(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := auditSnapshot(after)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO audit_log (created_at, actor, action, target, before, after, request_id) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		time.Now().Unix(), audit.Actor, action, target, beforeJSON, afterJSON, audit.RequestID)
+	if err != nil {
+		logError(ctx, "error writing audit log", err)
+	}
+	return err
+}
+
+// lists entries newest first
+func ListAudit(ctx context.Context, q AuditQuery) ([]AuditEntry, error) {
+	query := "SELECT id, created_at, actor, action, target, before, after, request_id FROM audit_log WHERE 1 = 1"
+	args := []any{}
+	if q.Actor != "" {
+		query += " AND actor = ?"
+		args = append(args, q.Actor)
+	}
+	if q.Action != "" {
+		query += " AND action = ?"
+		args = append(args, q.Action)
+	}
+	if q.Target != "" {
+		query += " AND target = ?"
+		args = append(args, q.Target)
+	}
+	query += " ORDER BY id DESC LIMIT ? OFFSET ?"
+	args = append(args, q.Limit, q.Offset)
+
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		logError(ctx, "error listing audit log", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var entry AuditEntry
+		var before, after sql.NullString
+		if err := rows.Scan(&entry.ID, &entry.CreatedAt, &entry.Actor, &entry.Action, &entry.Target, &before, &after, &entry.RequestID); err != nil {
+			logError(ctx, "error scanning row", err)
+			return nil, err
+		}
+		if before.Valid {
+			entry.Before = json.RawMessage(before.String)
+		}
+		if after.Valid {
+			entry.After = json.RawMessage(after.String)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
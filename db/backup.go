@@ -0,0 +1,152 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"go3/env"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+var ErrIntegrity = errors.New("integrity check failed")
+
+// copies the database to path with SQLite's online backup API
+// the file only shows up at path once it is complete and passed an integrity check
+func Backup(path string) error {
+	tmp := path + ".tmp"
+	os.Remove(tmp)
+	// a connection of its own, the pool may hand the source connection to a writer in the middle of the copy
+	srcDB, err := sql.Open("sqlite3", env.DBPath.Get())
+	if err != nil {
+		logError(context.Background(), "error backing up database", err)
+		return err
+	}
+	defer srcDB.Close()
+	if err := copyDatabase(srcDB, tmp); err != nil {
+		os.Remove(tmp)
+		logError(context.Background(), "error backing up database", err)
+		return err
+	}
+	if err := CheckIntegrity(tmp); err != nil {
+		os.Remove(tmp)
+		logError(context.Background(), "error checking backup", err)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		logError(context.Background(), "error saving backup", err)
+		return err
+	}
+	logInfo(context.Background(), "database backed up", "path", path)
+	return nil
+}
+
+// replaces the database at dest with the backup at src, nothing else may have dest open
+// the backup is checked before anything is overwritten, migrations run on the next start as usual
+func Restore(src string, dest string) error {
+	if _, err := os.Stat(src); err != nil {
+		return err
+	}
+	if err := CheckIntegrity(src); err != nil {
+		logError(context.Background(), "refusing to restore", err, "src", src)
+		return err
+	}
+	srcDB, err := sql.Open("sqlite3", src)
+	if err != nil {
+		return err
+	}
+	defer srcDB.Close()
+
+	if err := copyDatabase(srcDB, dest); err != nil {
+		logError(context.Background(), "error restoring database", err)
+		return err
+	}
+	if err := CheckIntegrity(dest); err != nil {
+		logError(context.Background(), "error checking restored database", err)
+		return err
+	}
+	logInfo(context.Background(), "database restored", "src", src)
+	return nil
+}
+
+// copies everything in one step: SQLite restarts a stepwise backup whenever another connection writes,
+// so on a busy database it might never finish. Writers wait for the copy instead
+func copyDatabase(src *sql.DB, destPath string) error {
+	ctx := context.Background()
+	destDB, err := sql.Open("sqlite3", destPath)
+	if err != nil {
+		return err
+	}
+	defer destDB.Close()
+
+	destConn, err := destDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	return destConn.Raw(func(destRaw any) error {
+		return srcConn.Raw(func(srcRaw any) error {
+			dest, ok := destRaw.(*sqlite3.SQLiteConn)
+			if !ok {
+				return fmt.Errorf("unexpected driver connection %T", destRaw)
+			}
+			source, ok := srcRaw.(*sqlite3.SQLiteConn)
+			if !ok {
+				return fmt.Errorf("unexpected driver connection %T", srcRaw)
+			}
+			backup, err := dest.Backup("main", source, "main")
+			if err != nil {
+				return err
+			}
+			if _, err := backup.Step(-1); err != nil {
+				backup.Finish()
+				return err
+			}
+			return backup.Finish()
+		})
+	})
+}
+
+// runs PRAGMA integrity_check on the database file at path
+func CheckIntegrity(path string) error {
+	check, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer check.Close()
+
+	rows, err := check.Query("PRAGMA integrity_check")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return err
+		}
+		if line != "ok" {
+			problems = append(problems, line)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrIntegrity, strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ban kinds: single addresses and API keys are stored as their hashed identity, ranges as CIDR text
+const (
+	BanIP   = "ip"
+	BanCIDR = "cidr"
+	BanKey  = "key"
+)
+
+type Ban struct {
+	ID        int64  `json:"id"`
+	Kind      string `json:"kind"`
+	Value     string `json:"value"`
+	Reason    string `json:"reason"`
+	CreatedAt int64  `json:"created_at"`
+	ExpiresAt int64  `json:"expires_at,omitempty"`
+}
+
+var ErrInvalidBan = errors.New("invalid ban value")
+
+// Active reports whether the ban still applies at now (unix time)
+func (b Ban) Active(now int64) bool {
+	return b.ExpiresAt == 0 || now < b.ExpiresAt
+}
+
+// turns what an admin typed into the stored value:
+// addresses and keys may be given raw or as the identity shown in reports and leaderboards
+func normalizeBanValue(kind string, value string) (string, error) {
+	value = strings.TrimSpace(value)
+	switch kind {
+	case BanIP:
+		if strings.HasPrefix(value, ipPrefix) {
+			return value, nil
+		}
+		if net.ParseIP(value) == nil {
+			return "", ErrInvalidBan
+		}
+		return HashIP(value), nil
+	case BanCIDR:
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return "", ErrInvalidBan
+		}
+		return network.String(), nil
+	case BanKey:
+		if value == "" {
+			return "", ErrInvalidBan
+		}
+		if strings.HasPrefix(value, "key:") {
+			return value, nil
+		}
+		return HashAPIKey(value), nil
+	}
+	return "", ErrInvalidBan
+}
+
+// adds the ban or replaces the reason and expiry of an existing one, expiresAt 0 never expires
+func AddBan(ctx context.Context, kind string, value string, reason string, expiresAt int64, audit Audit) (Ban, error) {
+	stored, err := normalizeBanValue(kind, value)
+	if err != nil {
+		return Ban{}, err
+	}
+	tx, err := DB.Begin()
+	if err != nil {
+		logError(ctx, "error starting transaction", err)
+		return Ban{}, err
+	}
+	defer tx.Rollback()
+
+	ban := Ban{Kind: kind, Value: stored, Reason: reason, CreatedAt: time.Now().Unix(), ExpiresAt: expiresAt}
+	expires := sql.NullInt64{Int64: expiresAt, Valid: expiresAt != 0}
+	err = tx.QueryRow(`INSERT INTO bans (kind, value, reason, created_at, expires_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(kind, value) DO UPDATE SET reason = excluded.reason, created_at = excluded.created_at, expires_at = excluded.expires_at
+		RETURNING id`, ban.Kind, ban.Value, ban.Reason, ban.CreatedAt, expires).Scan(&ban.ID)
+	if err != nil {
+		logError(ctx, "error saving ban", err)
+		return Ban{}, err
+	}
+	if err := writeAudit(ctx, tx, audit, AuditBanAdd, banTarget(ban.ID), nil, ban); err != nil {
+		return Ban{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		logError(ctx, "error saving ban", err)
+		return Ban{}, err
+	}
+	return ban, nil
+}
+
+func banTarget(id int64) string {
+	return "ban:" + strconv.FormatInt(id, 10)
+}
+
+const selectBans = "SELECT id, kind, value, reason, created_at, expires_at FROM bans"
+
+func scanBan(row scanner, ban *Ban) error {
+	var expires sql.NullInt64
+	err := row.Scan(&ban.ID, &ban.Kind, &ban.Value, &ban.Reason, &ban.CreatedAt, &expires)
+	ban.ExpiresAt = expires.Int64
+	return err
+}
+
+// returns sql.ErrNoRows when there is no such ban
+func DeleteBan(ctx context.Context, id int64, audit Audit) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		logError(ctx, "error starting transaction", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	var ban Ban
+	if err := scanBan(tx.QueryRow(selectBans+" WHERE id = ?", id), &ban); err != nil {
+		if err != sql.ErrNoRows {
+			logError(ctx, "error getting ban", err)
+		}
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM bans WHERE id = ?", id); err != nil {
+		logError(ctx, "error deleting ban", err)
+		return err
+	}
+	if err := writeAudit(ctx, tx, audit, AuditBanDelete, banTarget(id), ban, nil); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		logError(ctx, "error deleting ban", err)
+		return err
+	}
+	return nil
+}
+
+// lists bans newest first, expired ones only when includeExpired is set
+func ListBans(ctx context.Context, includeExpired bool) ([]Ban, error) {
+	query := selectBans
+	args := []any{}
+	if !includeExpired {
+		query += " WHERE expires_at IS NULL OR expires_at > ?"
+		args = append(args, time.Now().Unix())
+	}
+	query += " ORDER BY id DESC"
+
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		logError(ctx, "error listing bans", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	bans := []Ban{}
+	for rows.Next() {
+		var ban Ban
+		if err := scanBan(rows, &ban); err != nil {
+			logError(ctx, "error scanning row", err)
+			return nil, err
+		}
+		bans = append(bans, ban)
+	}
+	return bans, rows.Err()
+}
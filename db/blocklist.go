@@ -0,0 +1,158 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// blocklist kinds: an exact channel id or a regular expression matched against the title
+const (
+	BlockChannel = "channel"
+	BlockTitle   = "title"
+)
+
+type BlockEntry struct {
+	ID        int64  `json:"id"`
+	Kind      string `json:"kind"`
+	Pattern   string `json:"pattern"`
+	Note      string `json:"note"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+var ErrInvalidBlockEntry = errors.New("invalid blocklist entry")
+
+func AddBlockEntry(ctx context.Context, kind string, pattern string, note string, audit Audit) (BlockEntry, error) {
+	pattern = strings.TrimSpace(pattern)
+	switch kind {
+	case BlockChannel:
+		if pattern == "" {
+			return BlockEntry{}, ErrInvalidBlockEntry
+		}
+	case BlockTitle:
+		if _, err := regexp.Compile(pattern); err != nil || pattern == "" {
+			return BlockEntry{}, ErrInvalidBlockEntry
+		}
+	default:
+		return BlockEntry{}, ErrInvalidBlockEntry
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		logError(ctx, "error starting transaction", err)
+		return BlockEntry{}, err
+	}
+	defer tx.Rollback()
+
+	entry := BlockEntry{Kind: kind, Pattern: pattern, Note: note, CreatedAt: time.Now().Unix()}
+	err = tx.QueryRow(`INSERT INTO blocklist (kind, pattern, note, created_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(kind, pattern) DO UPDATE SET note = excluded.note
+		RETURNING id, created_at`, entry.Kind, entry.Pattern, entry.Note, entry.CreatedAt).Scan(&entry.ID, &entry.CreatedAt)
+	if err != nil {
+		logError(ctx, "error saving blocklist entry", err)
+		return BlockEntry{}, err
+	}
+	if err := writeAudit(ctx, tx, audit, AuditBlocklistAdd, blocklistTarget(entry.ID), nil, entry); err != nil {
+		return BlockEntry{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		logError(ctx, "error saving blocklist entry", err)
+		return BlockEntry{}, err
+	}
+	return entry, nil
+}
+
+func blocklistTarget(id int64) string {
+	return "blocklist:" + strconv.FormatInt(id, 10)
+}
+
+const selectBlockEntries = "SELECT id, kind, pattern, note, created_at FROM blocklist"
+
+func scanBlockEntry(row scanner, entry *BlockEntry) error {
+	return row.Scan(&entry.ID, &entry.Kind, &entry.Pattern, &entry.Note, &entry.CreatedAt)
+}
+
+// returns sql.ErrNoRows when there is no such entry
+func DeleteBlockEntry(ctx context.Context, id int64, audit Audit) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		logError(ctx, "error starting transaction", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	var entry BlockEntry
+	if err := scanBlockEntry(tx.QueryRow(selectBlockEntries+" WHERE id = ?", id), &entry); err != nil {
+		if err != sql.ErrNoRows {
+			logError(ctx, "error getting blocklist entry", err)
+		}
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM blocklist WHERE id = ?", id); err != nil {
+		logError(ctx, "error deleting blocklist entry", err)
+		return err
+	}
+	if err := writeAudit(ctx, tx, audit, AuditBlocklistDelete, blocklistTarget(id), entry, nil); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		logError(ctx, "error deleting blocklist entry", err)
+		return err
+	}
+	return nil
+}
+
+func ListBlockEntries(ctx context.Context) ([]BlockEntry, error) {
+	rows, err := DB.Query(selectBlockEntries + " ORDER BY id DESC")
+	if err != nil {
+		logError(ctx, "error listing blocklist", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []BlockEntry{}
+	for rows.Next() {
+		var entry BlockEntry
+		if err := scanBlockEntry(rows, &entry); err != nil {
+			logError(ctx, "error scanning row", err)
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// hides the given videos unless an admin already did, returns how many changed
+func HideVideos(ctx context.Context, ids []string, audit Audit) (int64, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		logError(ctx, "error starting transaction", err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var hidden int64
+	for _, id := range ids {
+		video, err := getVideoTx(tx, id)
+		if err == sql.ErrNoRows || video.Status == StatusHidden || video.DeletedAt != 0 {
+			continue
+		}
+		if err != nil {
+			logError(ctx, "error getting video", err)
+			return 0, err
+		}
+		if err := setVideoStatus(ctx, tx, id, StatusHidden, audit); err != nil {
+			return 0, err
+		}
+		hidden++
+	}
+	if err := tx.Commit(); err != nil {
+		logError(ctx, "error hiding videos", err)
+		return 0, err
+	}
+	return hidden, nil
+}
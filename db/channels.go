@@ -0,0 +1,95 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type Channel struct {
+	ID         string `json:"id"`
+	Title      string `json:"title"`
+	LogoURL    string `json:"logo_url"`
+	UpdatedAt  int64  `json:"updated_at"`
+	VideoCount int    `json:"video_count"`
+}
+
+// sort keys accepted by ListChannels
+const (
+	ChannelSortVideos = "videos"
+	ChannelSortTitle  = "title"
+)
+
+// the channel title lives here, saving a video with a new title renames the channel for all its videos
+func upsertChannel(tx *sql.Tx, id string, title string) error {
+	if id == "" {
+		return nil
+	}
+	_, err := tx.Exec(`INSERT INTO channels (id, title, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET title = excluded.title, updated_at = excluded.updated_at
+		WHERE channels.title IS NOT excluded.title`,
+		id, title, time.Now().Unix())
+	return err
+}
+
+// returns sql.ErrNoRows when the channel is unknown
+func GetChannel(ctx context.Context, id string) (Channel, error) {
+	defer observe("get_channel")()
+	var channel Channel
+	err := DB.QueryRow(`SELECT c.id, c.title, c.logo_url, c.updated_at, COUNT(v.id)
+		FROM channels c LEFT JOIN videos v ON v.channel_id = c.id AND `+visibleVideo+`
+		WHERE c.id = ? GROUP BY c.id`, id).
+		Scan(&channel.ID, &channel.Title, &channel.LogoURL, &channel.UpdatedAt, &channel.VideoCount)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logError(ctx, "error getting channel", err)
+		}
+		return Channel{}, err
+	}
+	return channel, nil
+}
+
+// lists channels that have at least one visible video
+func ListChannels(ctx context.Context, sort string, limit int, offset int) ([]Channel, error) {
+	defer observe("list_channels")()
+	order := "video_count DESC, c.title ASC"
+	if sort == ChannelSortTitle {
+		order = "c.title ASC"
+	}
+	stmt, err := DB.Prepare(`SELECT c.id, c.title, c.logo_url, c.updated_at, COUNT(v.id) AS video_count
+		FROM channels c JOIN videos v ON v.channel_id = c.id AND ` + visibleVideo + `
+		GROUP BY c.id ORDER BY ` + order + `, c.id ASC LIMIT ? OFFSET ?`)
+	if err != nil {
+		logError(ctx, "error preparing statement", err)
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(limit, offset)
+	if err != nil {
+		logError(ctx, "error listing channels", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	channels := []Channel{}
+	for rows.Next() {
+		var channel Channel
+		err = rows.Scan(&channel.ID, &channel.Title, &channel.LogoURL, &channel.UpdatedAt, &channel.VideoCount)
+		if err != nil {
+			logError(ctx, "error scanning row", err)
+			return nil, err
+		}
+		channels = append(channels, channel)
+	}
+	return channels, rows.Err()
+}
+
+// caches the channel logo so it is fetched from YouTube once
+func SetChannelLogo(ctx context.Context, id string, logoURL string) error {
+	_, err := DB.Exec("UPDATE channels SET logo_url = ? WHERE id = ?", logoURL, id)
+	if err != nil {
+		logError(ctx, "error saving channel logo", err)
+	}
+	return err
+}
@@ -1,10 +1,13 @@
 package db
 
 import (
+	"context"
 	"database/sql"
-	"log"
+	"errors"
+	"time"
 
 	"go3/env"
+	"go3/rng"
 )
 
 type Video struct {
@@ -15,16 +18,63 @@ type Video struct {
 	AddedAt         int64  `json:"added_at"`
 	AddedFromIP     string `json:"added_from_ip"`
 	ChannelID       string `json:"channel_id"`
+	Status          string `json:"status"`
+	Submitter       string `json:"submitter"`
+	DeletedAt       int64  `json:"deleted_at,omitempty"`
+	UpdatedAt       int64  `json:"updated_at"`
+}
+
+// video statuses, only active videos are served to the public endpoints
+// reported videos were hidden automatically and wait for an admin
+const (
+	StatusActive   = "active"
+	StatusReported = "reported"
+	StatusHidden   = "hidden"
+)
+
+func IsValidStatus(status string) bool {
+	return status == StatusActive || status == StatusReported || status == StatusHidden
 }
 
 var DB *sql.DB
 
+// every read of videos goes through these columns so the channel title comes from one place
+// video_author_username is only the fallback for videos without a channel row
+// UpdatedAt is the last change of the metadata, the status or the channel title
+const videoColumns = `v.id, v.video_name, COALESCE(NULLIF(c.title, ''), v.video_author_username), v.is_embeddable, v.added_at, COALESCE(v.added_from_ip, ''), v.channel_id, v.status, v.submitter, COALESCE(v.deleted_at, 0), MAX(COALESCE(v.updated_at, v.added_at), COALESCE(c.updated_at, 0))`
+
+const selectVideos = "SELECT " + videoColumns + " FROM videos v LEFT JOIN channels c ON c.id = v.channel_id"
+
+// soft deleted videos are skipped by every query unless it asks for them
+const notDeleted = "v.deleted_at IS NULL"
+
+// condition for videos the public endpoints may serve
+const visibleVideo = "v.status = '" + StatusActive + "' AND " + notDeleted
+
+// *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scans videoColumns, extra receives the columns selected after them
+func scanVideo(row scanner, video *Video, extra ...any) error {
+	dest := []any{&video.ID, &video.VideoName, &video.VideoAuthorName, &video.IsEmbeddable, &video.AddedAt, &video.AddedFromIP, &video.ChannelID, &video.Status, &video.Submitter, &video.DeletedAt, &video.UpdatedAt}
+	return row.Scan(append(dest, extra...)...)
+}
+
+// every command opens the db and the first open hashes the stored IPs for good,
+// without the key an address hashes to a plain SHA-256 that is cheap to reverse
+var errNoHashSecret = errors.New("IP_HASH_SECRET is not set")
+
 func InitDB() {
+	if env.IPHashSecret.Get() == "" {
+		fatal("refusing to open the database", errNoHashSecret)
+	}
 	db, err := sql.Open("sqlite3", env.DBPath.Get())
 	if err != nil {
-		log.Fatal("[db] Error opening database: ", err)
+		fatal("error opening database", err)
 	}
-	log.Println("[db] Database opened successfully: " + env.DBPath.Get())
+	logInfo(context.Background(), "database opened", "path", env.DBPath.Get())
 
 	// id (text),
 	// video_name (text),
@@ -36,9 +86,13 @@ func InitDB() {
 	sqlStmt := "CREATE TABLE IF NOT EXISTS videos (id TEXT PRIMARY KEY, video_name TEXT, video_author_username TEXT, is_embeddable BOOLEAN, added_at INTEGER, added_from_ip TEXT, channel_id TEXT)"
 	_, err = db.Exec(sqlStmt)
 	if err != nil {
-		log.Fatal("[db] Error creating table: ", err, sqlStmt)
+		fatal("error creating table", err, "stmt", sqlStmt)
+	}
+
+	if err := migrate(db); err != nil {
+		fatal("error migrating database", err)
 	}
-	log.Println("[db] Table created successfully")
+	initSearch(db)
 
 	DB = db
 }
@@ -50,49 +104,152 @@ func GetDB() *sql.DB {
 // does it handle duplicates?
 // answer: no
 // solution: use INSERT OR IGNORE
-func InsertVideo(video Video) error {
-	stmt, err := DB.Prepare("INSERT OR IGNORE INTO videos (id, video_name, video_author_username, is_embeddable, added_at, added_from_ip, channel_id) VALUES (?, ?, ?, ?, ?, ?, ?)")
+func InsertVideo(ctx context.Context, video Video, audit Audit) error {
+	defer observe("insert_video")()
+	tx, err := DB.Begin()
 	if err != nil {
-		log.Println("[db] Error preparing statement: ", err)
+		logError(ctx, "error starting transaction", err)
 		return err
 	}
-	_, err = stmt.Exec(video.ID, video.VideoName, video.VideoAuthorName, video.IsEmbeddable, video.AddedAt, video.AddedFromIP, video.ChannelID)
+	defer tx.Rollback()
+
+	res, err := tx.Exec("INSERT OR IGNORE INTO videos (id, video_name, video_author_username, is_embeddable, added_at, added_from_ip, channel_id, submitter) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		video.ID, video.VideoName, video.VideoAuthorName, video.IsEmbeddable, video.AddedAt, storedIP(video.AddedFromIP), video.ChannelID, video.Submitter)
 	if err != nil {
-		log.Println("[db] Error inserting video: ", err)
+		logError(ctx, "error inserting video", err)
+		return err
+	}
+	if err := upsertChannel(tx, video.ChannelID, video.VideoAuthorName); err != nil {
+		logError(ctx, "error saving channel", err)
 		return err
 	}
-	log.Println("[db] Video inserted successfully")
+	if n, _ := res.RowsAffected(); n > 0 {
+		after, err := getVideoTx(tx, video.ID)
+		if err != nil {
+			logError(ctx, "error getting video", err)
+			return err
+		}
+		if err := writeAudit(ctx, tx, audit, AuditVideoInsert, video.ID, nil, after); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		logError(ctx, "error inserting video", err)
+		return err
+	}
+	logInfo(ctx, "video inserted", "id", video.ID)
 	return nil
 }
 
-func GetRandomVideo() (Video, error) {
-	stmt, err := DB.Prepare("SELECT * FROM videos ORDER BY RANDOM() LIMIT 1")
+// picks a video using r so the same seed against the same catalog gives the same video
+// rows are ordered by id, ORDER BY RANDOM() can't be replayed
+func GetRandomVideo(ctx context.Context, r *rng.Rand) (Video, error) {
+	defer observe("random_video")()
+	return getRandomVideo(ctx, r, " WHERE "+visibleVideo)
+}
+
+// same as GetRandomVideo, limited to one channel
+func GetRandomChannelVideo(ctx context.Context, r *rng.Rand, channelID string) (Video, error) {
+	defer observe("random_channel_video")()
+	return getRandomVideo(ctx, r, " WHERE v.channel_id = ? AND "+visibleVideo, channelID)
+}
+
+func getRandomVideo(ctx context.Context, r *rng.Rand, where string, args ...any) (Video, error) {
+	var count int
+	err := DB.QueryRow("SELECT COUNT(*) FROM videos v"+where, args...).Scan(&count)
 	if err != nil {
-		log.Println("[db] Error preparing statement: ", err)
+		logError(ctx, "error getting number of videos", err)
+		return Video{}, err
+	}
+	if count == 0 {
+		logInfo(ctx, "no videos to pick a random one from")
+		return Video{}, sql.ErrNoRows
+	}
+
+	stmt, err := DB.Prepare(selectVideos + where + " ORDER BY v.id ASC LIMIT 1 OFFSET ?")
+	if err != nil {
+		logError(ctx, "error preparing statement", err)
+		return Video{}, err
+	}
+	defer stmt.Close()
+
+	var video Video
+	err = scanVideo(stmt.QueryRow(append(args, r.Intn(count))...), &video)
+	if err != nil {
+		logError(ctx, "error getting random video", err)
+		return Video{}, err
+	}
+	return video, nil
+}
+
+// reads a video inside tx for the audit snapshots, deleted videos included
+func getVideoTx(tx *sql.Tx, id string) (Video, error) {
+	var video Video
+	err := scanVideo(tx.QueryRow(selectVideos+" WHERE v.id = ?", id), &video)
+	return video, err
+}
+
+// returns sql.ErrNoRows when the video is not saved
+func GetVideo(ctx context.Context, id string) (Video, error) {
+	defer observe("get_video")()
+	stmt, err := DB.Prepare(selectVideos + " WHERE v.id = ? AND " + notDeleted)
+	if err != nil {
+		logError(ctx, "error preparing statement", err)
 		return Video{}, err
 	}
 	defer stmt.Close()
 
 	var video Video
-	err = stmt.QueryRow().Scan(&video.ID, &video.VideoName, &video.VideoAuthorName, &video.IsEmbeddable, &video.AddedAt, &video.AddedFromIP, &video.ChannelID)
+	err = scanVideo(stmt.QueryRow(id), &video)
 	if err != nil {
-		log.Println("[db] Error getting random video: ", err)
+		if err != sql.ErrNoRows {
+			logError(ctx, "error getting video", err)
+		}
 		return Video{}, err
 	}
 	return video, nil
 }
 
-func GetVideosByIP(ip string) ([]Video, error) {
-	stmt, err := DB.Prepare("SELECT * FROM videos WHERE added_from_ip = ?")
+// the ip is hashed the same way it was stored, videos sent with an API key match through their submitter
+func GetVideosByIP(ctx context.Context, ip string) ([]Video, error) {
+	hashed := HashIP(normalizeIP(ip))
+	stmt, err := DB.Prepare(selectVideos + " WHERE (v.added_from_ip = ? OR v.submitter = ?) AND " + notDeleted)
+	if err != nil {
+		logError(ctx, "error preparing statement", err)
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(hashed, hashed)
+	if err != nil {
+		logError(ctx, "error getting videos by IP", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var videos []Video
+	for rows.Next() {
+		var video Video
+		err = scanVideo(rows, &video)
+		if err != nil {
+			logError(ctx, "error scanning row", err)
+		}
+		videos = append(videos, video)
+	}
+	return videos, nil
+}
+
+func GetVideosBySubmitter(ctx context.Context, submitter string) ([]Video, error) {
+	stmt, err := DB.Prepare(selectVideos + " WHERE v.submitter = ? AND " + notDeleted)
 	if err != nil {
-		log.Println("[db] Error preparing statement: ", err)
+		logError(ctx, "error preparing statement", err)
 		return nil, err
 	}
 	defer stmt.Close()
 
-	rows, err := stmt.Query(ip)
+	rows, err := stmt.Query(submitter)
 	if err != nil {
-		log.Println("[db] Error getting videos by IP: ", err)
+		logError(ctx, "error getting videos by submitter", err)
 		return nil, err
 	}
 	defer rows.Close()
@@ -100,27 +257,27 @@ func GetVideosByIP(ip string) ([]Video, error) {
 	var videos []Video
 	for rows.Next() {
 		var video Video
-		err = rows.Scan(&video.ID, &video.VideoName, &video.VideoAuthorName, &video.IsEmbeddable, &video.AddedAt, &video.AddedFromIP, &video.ChannelID)
+		err = scanVideo(rows, &video)
 		if err != nil {
-			log.Println("[db] Error scanning row: ", err)
+			logError(ctx, "error scanning row", err)
 		}
 		videos = append(videos, video)
 	}
 	return videos, nil
 }
 
-func GetAllVideos() ([]Video, error) {
+func GetAllVideos(ctx context.Context) ([]Video, error) {
 	//sort by added_at oldest first (asc)
-	stmt, err := DB.Prepare("SELECT * FROM videos ORDER BY added_at ASC")
+	stmt, err := DB.Prepare(selectVideos + " WHERE " + notDeleted + " ORDER BY v.added_at ASC")
 	if err != nil {
-		log.Println("[db] Error preparing statement: ", err)
+		logError(ctx, "error preparing statement", err)
 		return nil, err
 	}
 	defer stmt.Close()
 
 	rows, err := stmt.Query()
 	if err != nil {
-		log.Println("[db] Error getting videos: ", err)
+		logError(ctx, "error getting videos", err)
 		return nil, err
 	}
 	defer rows.Close()
@@ -128,19 +285,42 @@ func GetAllVideos() ([]Video, error) {
 	var videos []Video
 	for rows.Next() {
 		var video Video
-		err = rows.Scan(&video.ID, &video.VideoName, &video.VideoAuthorName, &video.IsEmbeddable, &video.AddedAt, &video.AddedFromIP, &video.ChannelID)
+		err = scanVideo(rows, &video)
 		if err != nil {
-			log.Println("Error scanning row: ", err)
+			logError(ctx, "error scanning row", err)
 		}
 		videos = append(videos, video)
 	}
 	return videos, nil
 }
 
-func CountSavedVideos() (int, error) {
-	stmt, err := DB.Prepare("SELECT COUNT(*) FROM videos")
+// calls fn for every video oldest first without loading the whole catalog, stops at the first error fn returns
+func EachVideo(ctx context.Context, fn func(Video) error) error {
+	rows, err := DB.Query(selectVideos + " WHERE " + notDeleted + " ORDER BY v.added_at ASC, v.id ASC")
 	if err != nil {
-		log.Println("[db] Error preparing statement: ", err)
+		logError(ctx, "error getting videos", err)
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var video Video
+		if err := scanVideo(rows, &video); err != nil {
+			logError(ctx, "error scanning row", err)
+			return err
+		}
+		if err := fn(video); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func CountSavedVideos(ctx context.Context) (int, error) {
+	defer observe("count_videos")()
+	stmt, err := DB.Prepare("SELECT COUNT(*) FROM videos v WHERE " + notDeleted)
+	if err != nil {
+		logError(ctx, "error preparing statement", err)
 		return 0, err
 	}
 	defer stmt.Close()
@@ -148,58 +328,134 @@ func CountSavedVideos() (int, error) {
 	var count int
 	err = stmt.QueryRow().Scan(&count)
 	if err != nil {
-		log.Println("[db] Error getting number of videos: ", err)
+		logError(ctx, "error getting number of videos", err)
 		return 0, err
 	}
 	return count, nil
 }
 
-func IsVideoSaved(id string) (bool, error) {
-	stmt, err := DB.Prepare("SELECT * FROM videos WHERE id = ?")
+// counts saved videos per status
+func CountVideosByStatus(ctx context.Context) (map[string]int, error) {
+	rows, err := DB.Query("SELECT v.status, COUNT(*) FROM videos v WHERE " + notDeleted + " GROUP BY v.status")
 	if err != nil {
-		log.Println("[db] Error preparing statement: ", err)
+		logError(ctx, "error counting videos", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			logError(ctx, "error scanning row", err)
+			return nil, err
+		}
+		counts[status] = count
+	}
+	return counts, rows.Err()
+}
+
+func IsVideoSaved(ctx context.Context, id string) (bool, error) {
+	defer observe("is_video_saved")()
+	stmt, err := DB.Prepare(selectVideos + " WHERE v.id = ? AND " + notDeleted)
+	if err != nil {
+		logError(ctx, "error preparing statement", err)
 		return false, err
 	}
 	defer stmt.Close()
 
 	var video Video
-	err = stmt.QueryRow(id).Scan(&video.ID, &video.VideoName, &video.VideoAuthorName, &video.IsEmbeddable, &video.AddedAt, &video.AddedFromIP, &video.ChannelID)
+	err = scanVideo(stmt.QueryRow(id), &video)
 	if err != nil {
-		// log.Println("[db] Video not found: ", err)
+		// logInfo(ctx, "video not found", "id", id)
 		return false, nil
 	}
 	return true, nil
 }
 
-func ClearDB() {
-	stmt, err := DB.Prepare("DELETE FROM videos")
+// soft deletes every video, RestoreAllVideos brings them back until they are purged
+func ClearDB(ctx context.Context, audit Audit) error {
+	tx, err := DB.Begin()
 	if err != nil {
-		log.Println("[db] Error preparing statement: ", err)
-		return
+		logError(ctx, "error starting transaction", err)
+		return err
 	}
-	defer stmt.Close()
+	defer tx.Rollback()
 
-	_, err = stmt.Exec()
+	videos, err := queryVideosTx(ctx, tx, selectVideos+" WHERE "+notDeleted)
 	if err != nil {
-		log.Println("[db] Error clearing database: ", err)
-		return
+		return err
 	}
-	log.Println("[db] Database cleared successfully")
+	now := time.Now().Unix()
+	for _, video := range videos {
+		deleted := video
+		deleted.DeletedAt = now
+		if err := writeAudit(ctx, tx, audit, AuditVideoClear, video.ID, video, deleted); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE videos SET deleted_at = ? WHERE deleted_at IS NULL", now); err != nil {
+		logError(ctx, "error clearing database", err)
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		logError(ctx, "error clearing database", err)
+		return err
+	}
+	logInfo(ctx, "database cleared")
+	return nil
 }
 
-func UpdateVideo(video Video) error {
-	stmt, err := DB.Prepare("UPDATE videos SET video_name = ?, video_author_username = ?, is_embeddable = ?, added_at = ?, added_from_ip = ?, channel_id = ? WHERE id = ?")
+// saves refreshed YouTube metadata: name, author, embeddability and channel
+// added_at, added_from_ip, status and submitter are never touched
+// returns sql.ErrNoRows when the video is not saved
+func UpdateVideo(ctx context.Context, video Video, audit Audit) error {
+	defer observe("update_video")()
+	tx, err := DB.Begin()
 	if err != nil {
-		log.Println("[db] Error preparing statement: ", err)
+		logError(ctx, "error starting transaction", err)
 		return err
 	}
-	defer stmt.Close()
+	defer tx.Rollback()
+
+	before, err := getVideoTx(tx, video.ID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logError(ctx, "error getting video", err)
+		}
+		return err
+	}
+	if before.DeletedAt != 0 {
+		return sql.ErrNoRows
+	}
 
-	_, err = stmt.Exec(video.VideoName, video.VideoAuthorName, video.IsEmbeddable, video.AddedAt, video.AddedFromIP, video.ChannelID, video.ID)
+	_, err = tx.Exec("UPDATE videos SET video_name = ?, video_author_username = ?, is_embeddable = ?, channel_id = ?, updated_at = ? WHERE id = ?",
+		video.VideoName, video.VideoAuthorName, video.IsEmbeddable, video.ChannelID, time.Now().Unix(), video.ID)
 	if err != nil {
-		log.Println("[db] Error updating video: ", err)
+		logError(ctx, "error updating video", err)
+		return err
+	}
+	if err := upsertChannel(tx, video.ChannelID, video.VideoAuthorName); err != nil {
+		logError(ctx, "error saving channel", err)
+		return err
+	}
+	after, err := getVideoTx(tx, video.ID)
+	if err != nil {
+		logError(ctx, "error getting video", err)
+		return err
+	}
+	if err := recordRevisions(ctx, tx, before, after, RevisionRefresh); err != nil {
+		return err
+	}
+	if err := writeAudit(ctx, tx, audit, AuditVideoUpdate, video.ID, before, after); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		logError(ctx, "error updating video", err)
 		return err
 	}
-	log.Println("[db] Video updated successfully")
+	logInfo(ctx, "video updated", "id", video.ID)
 	return nil
 }
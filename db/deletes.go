@@ -0,0 +1,183 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// soft deletes the video, returns sql.ErrNoRows when it is not saved or already deleted
+func DeleteVideo(ctx context.Context, id string, audit Audit) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		logError(ctx, "error starting transaction", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := getVideoTx(tx, id)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logError(ctx, "error getting video", err)
+		}
+		return err
+	}
+	if before.DeletedAt != 0 {
+		return sql.ErrNoRows
+	}
+	after := before
+	after.DeletedAt = time.Now().Unix()
+	if _, err := tx.Exec("UPDATE videos SET deleted_at = ? WHERE id = ?", after.DeletedAt, id); err != nil {
+		logError(ctx, "error deleting video", err)
+		return err
+	}
+	if err := writeAudit(ctx, tx, audit, AuditVideoDelete, id, before, after); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		logError(ctx, "error deleting video", err)
+		return err
+	}
+	return nil
+}
+
+// returns whether the id belongs to a soft deleted video
+func IsVideoDeleted(ctx context.Context, id string) (bool, error) {
+	var deleted bool
+	err := DB.QueryRow("SELECT deleted_at IS NOT NULL FROM videos WHERE id = ?", id).Scan(&deleted)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		logError(ctx, "error checking if video is deleted", err)
+		return false, err
+	}
+	return deleted, nil
+}
+
+// brings back a soft deleted video, returns sql.ErrNoRows when there is no deleted video with that id
+func RestoreVideo(ctx context.Context, id string, audit Audit) error {
+	_, err := restoreVideos(ctx, audit, " AND v.id = ?", id)
+	return err
+}
+
+// brings back every soft deleted video, returns how many
+func RestoreAllVideos(ctx context.Context, audit Audit) (int, error) {
+	n, err := restoreVideos(ctx, audit, "")
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return n, err
+}
+
+func restoreVideos(ctx context.Context, audit Audit, where string, args ...any) (int, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		logError(ctx, "error starting transaction", err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	videos, err := queryVideosTx(ctx, tx, selectVideos+" WHERE v.deleted_at IS NOT NULL"+where, args...)
+	if err != nil {
+		return 0, err
+	}
+	if len(videos) == 0 {
+		return 0, sql.ErrNoRows
+	}
+	for _, before := range videos {
+		after := before
+		after.DeletedAt = 0
+		if _, err := tx.Exec("UPDATE videos SET deleted_at = NULL, updated_at = ? WHERE id = ?", time.Now().Unix(), before.ID); err != nil {
+			logError(ctx, "error restoring video", err)
+			return 0, err
+		}
+		if err := writeAudit(ctx, tx, audit, AuditVideoRestore, before.ID, before, after); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		logError(ctx, "error restoring videos", err)
+		return 0, err
+	}
+	return len(videos), nil
+}
+
+// soft deleted videos, most recently deleted first
+func ListDeletedVideos(ctx context.Context, limit int, offset int) ([]Video, error) {
+	rows, err := DB.Query(selectVideos+" WHERE v.deleted_at IS NOT NULL ORDER BY v.deleted_at DESC, v.id ASC LIMIT ? OFFSET ?", limit, offset)
+	if err != nil {
+		logError(ctx, "error listing deleted videos", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	videos := []Video{}
+	for rows.Next() {
+		var video Video
+		if err := scanVideo(rows, &video); err != nil {
+			logError(ctx, "error scanning row", err)
+			return nil, err
+		}
+		videos = append(videos, video)
+	}
+	return videos, rows.Err()
+}
+
+// removes videos soft deleted before the cutoff (unix time) for good, with their votes, reports, stats and revisions
+// the audit log keeps their last state
+func PurgeDeletedVideos(ctx context.Context, before int64, audit Audit) (int, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		logError(ctx, "error starting transaction", err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	videos, err := queryVideosTx(ctx, tx, selectVideos+" WHERE v.deleted_at IS NOT NULL AND v.deleted_at < ?", before)
+	if err != nil {
+		return 0, err
+	}
+	for _, video := range videos {
+		for _, stmt := range []string{
+			"DELETE FROM votes WHERE video_id = ?",
+			"DELETE FROM reports WHERE video_id = ?",
+			"DELETE FROM video_stats WHERE video_id = ?",
+			"DELETE FROM video_revisions WHERE video_id = ?",
+			"DELETE FROM videos WHERE id = ?",
+		} {
+			if _, err := tx.Exec(stmt, video.ID); err != nil {
+				logError(ctx, "error purging video", err)
+				return 0, err
+			}
+		}
+		if err := writeAudit(ctx, tx, audit, AuditVideoPurge, video.ID, video, nil); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		logError(ctx, "error purging videos", err)
+		return 0, err
+	}
+	return len(videos), nil
+}
+
+func queryVideosTx(ctx context.Context, tx *sql.Tx, query string, args ...any) ([]Video, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		logError(ctx, "error getting videos", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var videos []Video
+	for rows.Next() {
+		var video Video
+		if err := scanVideo(rows, &video); err != nil {
+			logError(ctx, "error scanning row", err)
+			return nil, err
+		}
+		videos = append(videos, video)
+	}
+	return videos, rows.Err()
+}
@@ -0,0 +1,128 @@
+package db
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"net"
+	"strings"
+
+	"go3/env"
+)
+
+// identities are stored instead of raw IPs and API keys,
+// keyed with IP_HASH_SECRET so the small IPv4 space can't be brute forced back
+func HashIP(ip string) string {
+	return ipPrefix + keyedHash(ip)
+}
+
+func HashAPIKey(key string) string {
+	return "key:" + keyedHash(key)
+}
+
+func keyedHash(value string) string {
+	// InitDB refuses to run without the secret
+	mac := hmac.New(sha256.New, []byte(env.IPHashSecret.Get()))
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// older rows stored whatever the request carried: a whole X-Forwarded-For chain or host:port
+func normalizeIP(raw string) string {
+	first, _, _ := strings.Cut(raw, ",")
+	first = strings.TrimSpace(first)
+	if host, _, err := net.SplitHostPort(first); err == nil {
+		return host
+	}
+	return first
+}
+
+// markers stored in added_from_ip that are not addresses
+const (
+	IPMigrated = "migrated"
+	ipPrefix   = "ip:"
+)
+
+// added_from_ip only ever holds the keyed hash, values that are already hashed or not addresses pass through
+func storedIP(raw string) string {
+	if raw == "" || raw == IPMigrated || strings.HasPrefix(raw, ipPrefix) {
+		return raw
+	}
+	return HashIP(normalizeIP(raw))
+}
+
+// prefix of the random ids that replace address based submitters once their addresses expire
+const anonPrefix = "anon:"
+
+// forgets the submitting address of videos added before the cutoff (unix time)
+// submitters derived from the address get a random id instead, one per address,
+// so the leaderboard still groups their old videos but nothing leads back to the address
+func ExpireSubmitterIPs(ctx context.Context, before int64, audit Audit) (int64, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		logError(ctx, "error starting transaction", err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("UPDATE videos SET added_from_ip = NULL WHERE added_from_ip IS NOT NULL AND added_from_ip != ? AND added_at < ?", IPMigrated, before)
+	if err != nil {
+		logError(ctx, "error expiring submitter IPs", err)
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	rekeyed, err := rekeySubmitters(tx, before)
+	if err != nil {
+		logError(ctx, "error expiring submitter IPs", err)
+		return 0, err
+	}
+	if n == 0 && rekeyed == 0 {
+		return 0, nil
+	}
+	// one entry for the whole sweep, the addresses themselves must not end up in the log
+	summary := map[string]int64{"added_before": before, "videos": n, "submitters": rekeyed}
+	if err := writeAudit(ctx, tx, audit, AuditVideoExpireIPs, "", nil, summary); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		logError(ctx, "error expiring submitter IPs", err)
+		return 0, err
+	}
+	return n, nil
+}
+
+// replaces the address based submitter of videos added before the cutoff, returns how many submitters were replaced
+func rekeySubmitters(tx *sql.Tx, before int64) (int64, error) {
+	rows, err := tx.Query("SELECT DISTINCT submitter FROM videos WHERE submitter LIKE ? AND added_at < ?", ipPrefix+"%", before)
+	if err != nil {
+		return 0, err
+	}
+	var submitters []string
+	for rows.Next() {
+		var submitter string
+		if err := rows.Scan(&submitter); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		submitters = append(submitters, submitter)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, submitter := range submitters {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return 0, err
+		}
+		_, err := tx.Exec("UPDATE videos SET submitter = ? WHERE submitter = ? AND added_at < ?", anonPrefix+hex.EncodeToString(b), submitter, before)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(submitters)), nil
+}
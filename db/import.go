@@ -0,0 +1,128 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// what an import does with a video that is already saved
+const (
+	ImportSkip      = "skip"
+	ImportOverwrite = "overwrite"
+	// overwrite only when the imported copy changed later than the saved one
+	ImportNewer = "newer"
+)
+
+func IsValidImportPolicy(policy string) bool {
+	return policy == ImportSkip || policy == ImportOverwrite || policy == ImportNewer
+}
+
+type ImportSummary struct {
+	Inserted int `json:"inserted"`
+	Updated  int `json:"updated"`
+	Skipped  int `json:"skipped"`
+}
+
+// videos saved per transaction, a big import must not hold the write lock for its whole length
+const ImportBatchSize = 500
+
+func (s ImportSummary) Total() int {
+	return s.Inserted + s.Updated + s.Skipped
+}
+
+// Importer saves videos in batches, each batch in its own transaction
+// the caller decodes a batch before handing it over so no transaction waits on a slow reader
+type Importer struct {
+	ctx     context.Context
+	policy  string
+	audit   Audit
+	Summary ImportSummary
+}
+
+func NewImporter(ctx context.Context, policy string, audit Audit) *Importer {
+	return &Importer{ctx: ctx, policy: policy, audit: audit}
+}
+
+// saves the videos in one transaction, nothing of the batch is saved when one of them fails
+func (im *Importer) AddBatch(videos []Video) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		logError(im.ctx, "error starting transaction", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	summary := im.Summary
+	for _, video := range videos {
+		if err := im.add(tx, &summary, video); err != nil {
+			return fmt.Errorf("video '%s': %w", video.ID, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		logError(im.ctx, "error importing videos", err)
+		return err
+	}
+	im.Summary = summary
+	return nil
+}
+
+func (im *Importer) Done() {
+	logInfo(im.ctx, "import done", "inserted", im.Summary.Inserted, "updated", im.Summary.Updated, "skipped", im.Summary.Skipped)
+}
+
+// saves one video according to the policy, soft deleted videos are never brought back by an import
+// updated_at travels with the video so "newer" compares the last changes, added_at never moves
+func (im *Importer) add(tx *sql.Tx, summary *ImportSummary, video Video) error {
+	if video.Status == "" {
+		video.Status = StatusActive
+	}
+	before, err := getVideoTx(tx, video.ID)
+	exists := err == nil
+	if err != nil && err != sql.ErrNoRows {
+		logError(im.ctx, "error getting video", err)
+		return err
+	}
+	if exists && (before.DeletedAt != 0 || im.policy == ImportSkip || (im.policy == ImportNewer && updatedAt(video) <= before.UpdatedAt)) {
+		summary.Skipped++
+		return nil
+	}
+
+	_, err = tx.Exec(`INSERT INTO videos (id, video_name, video_author_username, is_embeddable, added_at, added_from_ip, channel_id, status, submitter, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET video_name = excluded.video_name, video_author_username = excluded.video_author_username, is_embeddable = excluded.is_embeddable,
+			added_from_ip = excluded.added_from_ip, channel_id = excluded.channel_id, status = excluded.status, submitter = excluded.submitter, updated_at = excluded.updated_at`,
+		video.ID, video.VideoName, video.VideoAuthorName, video.IsEmbeddable, video.AddedAt, storedIP(video.AddedFromIP), video.ChannelID, video.Status, video.Submitter, max(updatedAt(video), before.UpdatedAt))
+	if err != nil {
+		logError(im.ctx, "error importing video", err)
+		return err
+	}
+	if err := upsertChannel(tx, video.ChannelID, video.VideoAuthorName); err != nil {
+		logError(im.ctx, "error saving channel", err)
+		return err
+	}
+	after, err := getVideoTx(tx, video.ID)
+	if err != nil {
+		logError(im.ctx, "error getting video", err)
+		return err
+	}
+
+	var snapshot any
+	if exists {
+		if err := recordRevisions(im.ctx, tx, before, after, RevisionImport); err != nil {
+			return err
+		}
+		snapshot = before
+		summary.Updated++
+	} else {
+		summary.Inserted++
+	}
+	return writeAudit(im.ctx, tx, im.audit, AuditVideoImport, video.ID, snapshot, after)
+}
+
+// files written before updated_at was exported only know when the video was added
+func updatedAt(video Video) int64 {
+	if video.UpdatedAt == 0 {
+		return video.AddedAt
+	}
+	return video.UpdatedAt
+}
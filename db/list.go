@@ -0,0 +1,151 @@
+package db
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// sort keys accepted by ListVideos
+const (
+	SortAddedAt = "added_at"
+	SortTitle   = "title"
+	SortChannel = "channel"
+)
+
+var sortColumns = map[string]string{
+	SortAddedAt: "v.added_at",
+	SortTitle:   "v.video_name",
+	SortChannel: "COALESCE(NULLIF(c.title, ''), v.video_author_username)",
+}
+
+// ListQuery describes one page of the catalog
+// pages are keyset based: AfterValue/AfterID are the sort value and id of the last row of the previous page
+type ListQuery struct {
+	Sort  string
+	Desc  bool
+	Limit int
+
+	ChannelID   string
+	Submitter   string
+	Embeddable  *bool
+	AddedAfter  int64
+	AddedBefore int64
+
+	AfterValue string
+	AfterID    string
+}
+
+type VideoPage struct {
+	Videos []Video
+	More   bool
+}
+
+func IsValidSort(sort string) bool {
+	_, ok := sortColumns[sort]
+	return ok
+}
+
+// returns the value of the sort column for video, used to build the next cursor
+func (q ListQuery) SortValue(video Video) string {
+	switch q.Sort {
+	case SortTitle:
+		return video.VideoName
+	case SortChannel:
+		return video.VideoAuthorName
+	default:
+		return strconv.FormatInt(video.AddedAt, 10)
+	}
+}
+
+// converts the sort value of a cursor to what the sort column holds, added_at is a number
+func ParseSortValue(sort string, value string) (any, error) {
+	if sort == SortAddedAt {
+		return strconv.ParseInt(value, 10, 64)
+	}
+	return value, nil
+}
+
+// reads a single page without loading the rest of the table
+func ListVideos(ctx context.Context, q ListQuery) (VideoPage, error) {
+	defer observe("list_videos")()
+	column, ok := sortColumns[q.Sort]
+	if !ok {
+		q.Sort = SortAddedAt
+		column = sortColumns[SortAddedAt]
+	}
+	dir, cmp := "ASC", ">"
+	if q.Desc {
+		dir, cmp = "DESC", "<"
+	}
+
+	where := []string{visibleVideo}
+	var args []any
+	if q.ChannelID != "" {
+		where = append(where, "v.channel_id = ?")
+		args = append(args, q.ChannelID)
+	}
+	if q.Submitter != "" {
+		where = append(where, "v.submitter = ?")
+		args = append(args, q.Submitter)
+	}
+	if q.Embeddable != nil {
+		where = append(where, "v.is_embeddable = ?")
+		args = append(args, *q.Embeddable)
+	}
+	if q.AddedAfter > 0 {
+		where = append(where, "v.added_at >= ?")
+		args = append(args, q.AddedAfter)
+	}
+	if q.AddedBefore > 0 {
+		where = append(where, "v.added_at < ?")
+		args = append(args, q.AddedBefore)
+	}
+	if q.AfterID != "" {
+		after, err := ParseSortValue(q.Sort, q.AfterValue)
+		if err != nil {
+			return VideoPage{}, err
+		}
+		where = append(where, "("+column+" "+cmp+" ? OR ("+column+" = ? AND v.id "+cmp+" ?))")
+		args = append(args, after, after, q.AfterID)
+	}
+
+	query := selectVideos + " WHERE " + strings.Join(where, " AND ")
+	// one extra row tells us whether there is a next page
+	query += " ORDER BY " + column + " " + dir + ", v.id " + dir + " LIMIT ?"
+	args = append(args, q.Limit+1)
+
+	stmt, err := DB.Prepare(query)
+	if err != nil {
+		logError(ctx, "error preparing statement", err)
+		return VideoPage{}, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(args...)
+	if err != nil {
+		logError(ctx, "error listing videos", err)
+		return VideoPage{}, err
+	}
+	defer rows.Close()
+
+	var page VideoPage
+	for rows.Next() {
+		var video Video
+		err = scanVideo(rows, &video)
+		if err != nil {
+			logError(ctx, "error scanning row", err)
+			return VideoPage{}, err
+		}
+		page.Videos = append(page.Videos, video)
+	}
+	if err := rows.Err(); err != nil {
+		logError(ctx, "error listing videos", err)
+		return VideoPage{}, err
+	}
+	if len(page.Videos) > q.Limit {
+		page.Videos = page.Videos[:q.Limit]
+		page.More = true
+	}
+	return page, nil
+}
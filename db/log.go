@@ -0,0 +1,23 @@
+package db
+
+import (
+	"context"
+	"log/slog"
+	"os"
+)
+
+// db logs through the default slog logger, ctx carries the request id of the caller
+
+func logError(ctx context.Context, msg string, err error, args ...any) {
+	slog.ErrorContext(ctx, msg, append([]any{"component", "db", "err", err}, args...)...)
+}
+
+func logInfo(ctx context.Context, msg string, args ...any) {
+	slog.InfoContext(ctx, msg, append([]any{"component", "db"}, args...)...)
+}
+
+// the database is unusable, like log.Fatal
+func fatal(msg string, err error, args ...any) {
+	logError(context.Background(), msg, err, args...)
+	os.Exit(1)
+}
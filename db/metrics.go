@@ -0,0 +1,17 @@
+package db
+
+import (
+	"time"
+
+	"go3/metrics"
+)
+
+var queryDuration = metrics.NewHistogramVec("db_query_duration_seconds", "Time spent in db calls by operation.", metrics.DefaultBuckets, "op")
+
+// times a db call: defer observe("get_video")()
+func observe(op string) func() {
+	start := time.Now()
+	return func() {
+		queryDuration.Since(start, op)
+	}
+}
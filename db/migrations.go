@@ -0,0 +1,252 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+type migration struct {
+	name string
+	up   func(tx *sql.Tx) error
+}
+
+// applied in order on startup, PRAGMA user_version holds how many already ran
+// only ever append to this list, never edit or reorder applied entries
+var migrations = []migration{
+	{"create channels", migrateCreateChannels},
+	{"create votes", migrateCreateVotes},
+	{"add video status and reports", migrateCreateReports},
+	{"create video stats", migrateCreateVideoStats},
+	{"add video submitter", migrateAddSubmitter},
+	{"hash submitter IPs", migrateHashIPs},
+	{"create bans", migrateCreateBans},
+	{"create blocklist", migrateCreateBlocklist},
+	{"create audit log", migrateCreateAuditLog},
+	{"add video soft delete", migrateAddDeletedAt},
+	{"create video revisions", migrateCreateRevisions},
+	{"create api keys", migrateCreateAPIKeys},
+	{"add video updated_at", migrateAddUpdatedAt},
+}
+
+func migrate(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	for i := version; i < len(migrations); i++ {
+		m := migrations[i]
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if err := m.up(tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d (%s): %w", i+1, m.name, err)
+		}
+		// PRAGMA can't take bound parameters
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		logInfo(context.Background(), "applied migration", "version", i+1, "name", m.name)
+	}
+	return nil
+}
+
+// returns the schema version of the open database
+func SchemaVersion() (int, error) {
+	var version int
+	err := DB.QueryRow("PRAGMA user_version").Scan(&version)
+	return version, err
+}
+
+// returns the schema version this build expects
+func LatestSchemaVersion() int {
+	return len(migrations)
+}
+
+func migrateCreateChannels(tx *sql.Tx) error {
+	_, err := tx.Exec("CREATE TABLE IF NOT EXISTS channels (id TEXT PRIMARY KEY, title TEXT, logo_url TEXT NOT NULL DEFAULT '', updated_at INTEGER)")
+	if err != nil {
+		return err
+	}
+	// latest added video wins when the channel was renamed between submissions
+	_, err = tx.Exec(`INSERT OR IGNORE INTO channels (id, title, updated_at)
+		SELECT channel_id, video_author_username, MAX(added_at) FROM videos
+		WHERE channel_id IS NOT NULL AND channel_id != ''
+		GROUP BY channel_id`)
+	return err
+}
+
+func migrateCreateVotes(tx *sql.Tx) error {
+	_, err := tx.Exec("CREATE TABLE IF NOT EXISTS votes (video_id TEXT NOT NULL, voter TEXT NOT NULL, value INTEGER NOT NULL, voted_at INTEGER NOT NULL, PRIMARY KEY (video_id, voter))")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("CREATE INDEX IF NOT EXISTS votes_voted_at ON votes (voted_at)")
+	return err
+}
+
+func migrateCreateReports(tx *sql.Tx) error {
+	stmts := []string{
+		"ALTER TABLE videos ADD COLUMN status TEXT NOT NULL DEFAULT 'active'",
+		"CREATE TABLE IF NOT EXISTS reports (id INTEGER PRIMARY KEY AUTOINCREMENT, video_id TEXT NOT NULL, reporter TEXT NOT NULL, reason TEXT NOT NULL, note TEXT NOT NULL DEFAULT '', created_at INTEGER NOT NULL, resolved_at INTEGER, resolution TEXT)",
+		// a reporter counts once per video until their report is resolved
+		"CREATE UNIQUE INDEX IF NOT EXISTS reports_open_reporter ON reports (video_id, reporter) WHERE resolved_at IS NULL",
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func migrateCreateVideoStats(tx *sql.Tx) error {
+	_, err := tx.Exec("CREATE TABLE IF NOT EXISTS video_stats (video_id TEXT NOT NULL, day TEXT NOT NULL, impressions INTEGER NOT NULL DEFAULT 0, plays INTEGER NOT NULL DEFAULT 0, PRIMARY KEY (video_id, day))")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("CREATE INDEX IF NOT EXISTS video_stats_day ON video_stats (day)")
+	return err
+}
+
+func migrateAddSubmitter(tx *sql.Tx) error {
+	if _, err := tx.Exec("ALTER TABLE videos ADD COLUMN submitter TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("CREATE INDEX IF NOT EXISTS videos_submitter ON videos (submitter)"); err != nil {
+		return err
+	}
+
+	// hashing happens in go, read everything first so the update doesn't run while rows are open
+	rows, err := tx.Query("SELECT id, added_from_ip FROM videos WHERE added_from_ip IS NOT NULL AND added_from_ip NOT IN ('', ?)", IPMigrated)
+	if err != nil {
+		return err
+	}
+	submitters := map[string]string{}
+	for rows.Next() {
+		var id, ip string
+		if err := rows.Scan(&id, &ip); err != nil {
+			rows.Close()
+			return err
+		}
+		submitters[id] = HashIP(normalizeIP(ip))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, submitter := range submitters {
+		if _, err := tx.Exec("UPDATE videos SET submitter = ? WHERE id = ?", submitter, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// one-shot rewrite of the raw addresses stored before added_from_ip was hashed
+func migrateHashIPs(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT id, added_from_ip FROM videos WHERE added_from_ip IS NOT NULL")
+	if err != nil {
+		return err
+	}
+	hashed := map[string]string{}
+	for rows.Next() {
+		var id, ip string
+		if err := rows.Scan(&id, &ip); err != nil {
+			rows.Close()
+			return err
+		}
+		if stored := storedIP(ip); stored != ip {
+			hashed[id] = stored
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, ip := range hashed {
+		if _, err := tx.Exec("UPDATE videos SET added_from_ip = ? WHERE id = ?", ip, id); err != nil {
+			return err
+		}
+	}
+	logInfo(context.Background(), "hashed submitter IPs", "videos", len(hashed))
+	return nil
+}
+
+func migrateCreateBans(tx *sql.Tx) error {
+	_, err := tx.Exec("CREATE TABLE IF NOT EXISTS bans (id INTEGER PRIMARY KEY AUTOINCREMENT, kind TEXT NOT NULL, value TEXT NOT NULL, reason TEXT NOT NULL DEFAULT '', created_at INTEGER NOT NULL, expires_at INTEGER, UNIQUE (kind, value))")
+	return err
+}
+
+func migrateCreateAPIKeys(tx *sql.Tx) error {
+	_, err := tx.Exec("CREATE TABLE IF NOT EXISTS api_keys (id INTEGER PRIMARY KEY AUTOINCREMENT, identity TEXT NOT NULL UNIQUE, note TEXT NOT NULL DEFAULT '', created_at INTEGER NOT NULL)")
+	return err
+}
+
+func migrateCreateBlocklist(tx *sql.Tx) error {
+	_, err := tx.Exec("CREATE TABLE IF NOT EXISTS blocklist (id INTEGER PRIMARY KEY AUTOINCREMENT, kind TEXT NOT NULL, pattern TEXT NOT NULL, note TEXT NOT NULL DEFAULT '', created_at INTEGER NOT NULL, UNIQUE (kind, pattern))")
+	return err
+}
+
+// the audit log is append-only, the triggers refuse to change or remove entries
+func migrateCreateAuditLog(tx *sql.Tx) error {
+	stmts := []string{
+		"CREATE TABLE IF NOT EXISTS audit_log (id INTEGER PRIMARY KEY AUTOINCREMENT, created_at INTEGER NOT NULL, actor TEXT NOT NULL, action TEXT NOT NULL, target TEXT NOT NULL DEFAULT '', before TEXT, after TEXT, request_id TEXT NOT NULL DEFAULT '')",
+		"CREATE INDEX IF NOT EXISTS audit_log_target ON audit_log (target)",
+		"CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log BEGIN SELECT RAISE(ABORT, 'audit log is append-only'); END",
+		"CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log BEGIN SELECT RAISE(ABORT, 'audit log is append-only'); END",
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func migrateAddDeletedAt(tx *sql.Tx) error {
+	stmts := []string{
+		"ALTER TABLE videos ADD COLUMN deleted_at INTEGER",
+		"CREATE INDEX IF NOT EXISTS videos_deleted_at ON videos (deleted_at) WHERE deleted_at IS NOT NULL",
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func migrateCreateRevisions(tx *sql.Tx) error {
+	stmts := []string{
+		"CREATE TABLE IF NOT EXISTS video_revisions (id INTEGER PRIMARY KEY AUTOINCREMENT, video_id TEXT NOT NULL, field TEXT NOT NULL, old_value TEXT NOT NULL, new_value TEXT NOT NULL, changed_at INTEGER NOT NULL, source TEXT NOT NULL)",
+		"CREATE INDEX IF NOT EXISTS video_revisions_video ON video_revisions (video_id, id)",
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func migrateAddUpdatedAt(tx *sql.Tx) error {
+	stmts := []string{
+		"ALTER TABLE videos ADD COLUMN updated_at INTEGER",
+		"UPDATE videos SET updated_at = added_at",
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type Report struct {
+	ID         int64  `json:"id"`
+	VideoID    string `json:"video_id"`
+	Reporter   string `json:"reporter"`
+	Reason     string `json:"reason"`
+	Note       string `json:"note"`
+	CreatedAt  int64  `json:"created_at"`
+	ResolvedAt int64  `json:"resolved_at,omitempty"`
+	Resolution string `json:"resolution,omitempty"`
+}
+
+// reasons a video can be reported for
+const (
+	ReasonBroken        = "broken"
+	ReasonInappropriate = "inappropriate"
+	ReasonSpam          = "spam"
+	ReasonOther         = "other"
+)
+
+// how an admin closed a report
+const (
+	ResolutionDismissed = "dismissed"
+	ResolutionHidden    = "hidden"
+)
+
+// report filters accepted by ListReports
+const (
+	ReportsOpen     = "open"
+	ReportsResolved = "resolved"
+	ReportsAll      = "all"
+)
+
+var (
+	ErrDuplicateReport = errors.New("video already reported by this client")
+	ErrReportResolved  = errors.New("report is already resolved")
+)
+
+func IsValidReportReason(reason string) bool {
+	switch reason {
+	case ReasonBroken, ReasonInappropriate, ReasonSpam, ReasonOther:
+		return true
+	}
+	return false
+}
+
+// counts distinct clients with an open report on the video
+func countOpenReports(tx *sql.Tx, videoID string) (int, error) {
+	var count int
+	err := tx.QueryRow("SELECT COUNT(DISTINCT reporter) FROM reports WHERE video_id = ? AND resolved_at IS NULL", videoID).Scan(&count)
+	return count, err
+}
+
+// saves the report and takes the video out of rotation once hideThreshold distinct clients reported it
+// returns whether this report hid the video, both the report and the hiding are audited as the reporter
+func AddReport(ctx context.Context, videoID string, reporter string, reason string, note string, hideThreshold int, audit Audit) (bool, error) {
+	defer observe("add_report")()
+	tx, err := DB.Begin()
+	if err != nil {
+		logError(ctx, "error starting transaction", err)
+		return false, err
+	}
+	defer tx.Rollback()
+
+	report := Report{VideoID: videoID, Reporter: reporter, Reason: reason, Note: note, CreatedAt: time.Now().Unix()}
+	err = tx.QueryRow("INSERT INTO reports (video_id, reporter, reason, note, created_at) VALUES (?, ?, ?, ?, ?) ON CONFLICT DO NOTHING RETURNING id",
+		report.VideoID, report.Reporter, report.Reason, report.Note, report.CreatedAt).Scan(&report.ID)
+	if err == sql.ErrNoRows {
+		return false, ErrDuplicateReport
+	}
+	if err != nil {
+		logError(ctx, "error inserting report", err)
+		return false, err
+	}
+	if err := writeAudit(ctx, tx, audit, AuditReportAdd, videoID, nil, report); err != nil {
+		return false, err
+	}
+
+	count, err := countOpenReports(tx, videoID)
+	if err != nil {
+		logError(ctx, "error counting reports", err)
+		return false, err
+	}
+	hidden := false
+	if hideThreshold > 0 && count >= hideThreshold {
+		res, err := tx.Exec("UPDATE videos SET status = ?, updated_at = ? WHERE id = ? AND status = ?", StatusReported, time.Now().Unix(), videoID, StatusActive)
+		if err != nil {
+			logError(ctx, "error hiding video", err)
+			return false, err
+		}
+		n, _ := res.RowsAffected()
+		hidden = n > 0
+	}
+	if hidden {
+		after, err := getVideoTx(tx, videoID)
+		if err != nil {
+			logError(ctx, "error getting video", err)
+			return false, err
+		}
+		before := after
+		before.Status = StatusActive
+		if err := recordRevisions(ctx, tx, before, after, RevisionReport); err != nil {
+			return false, err
+		}
+		if err := writeAudit(ctx, tx, audit, AuditVideoStatus, videoID, before, after); err != nil {
+			return false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		logError(ctx, "error inserting report", err)
+		return false, err
+	}
+	if hidden {
+		logInfo(ctx, "video hidden after reports", "id", videoID, "reports", count)
+	}
+	return hidden, nil
+}
+
+func scanReport(row scanner, report *Report) error {
+	var resolvedAt sql.NullInt64
+	var resolution sql.NullString
+	err := row.Scan(&report.ID, &report.VideoID, &report.Reporter, &report.Reason, &report.Note, &report.CreatedAt, &resolvedAt, &resolution)
+	report.ResolvedAt = resolvedAt.Int64
+	report.Resolution = resolution.String
+	return err
+}
+
+const selectReports = "SELECT id, video_id, reporter, reason, note, created_at, resolved_at, resolution FROM reports"
+
+func ListReports(ctx context.Context, status string, limit int, offset int) ([]Report, error) {
+	query := selectReports
+	switch status {
+	case ReportsOpen:
+		query += " WHERE resolved_at IS NULL"
+	case ReportsResolved:
+		query += " WHERE resolved_at IS NOT NULL"
+	}
+	query += " ORDER BY id DESC LIMIT ? OFFSET ?"
+
+	rows, err := DB.Query(query, limit, offset)
+	if err != nil {
+		logError(ctx, "error listing reports", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := []Report{}
+	for rows.Next() {
+		var report Report
+		if err := scanReport(rows, &report); err != nil {
+			logError(ctx, "error scanning row", err)
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, rows.Err()
+}
+
+// closes an open report; hiding keeps the video out for good,
+// dismissing puts an auto-hidden video back once it is under hideThreshold open reports
+func ResolveReport(ctx context.Context, id int64, resolution string, hideThreshold int, audit Audit) (Report, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		logError(ctx, "error starting transaction", err)
+		return Report{}, err
+	}
+	defer tx.Rollback()
+
+	var report Report
+	if err := scanReport(tx.QueryRow(selectReports+" WHERE id = ?", id), &report); err != nil {
+		if err != sql.ErrNoRows {
+			logError(ctx, "error getting report", err)
+		}
+		return Report{}, err
+	}
+	if report.ResolvedAt != 0 {
+		return report, ErrReportResolved
+	}
+	open := report
+	before, err := getVideoTx(tx, report.VideoID)
+	if err != nil && err != sql.ErrNoRows {
+		logError(ctx, "error getting video", err)
+		return Report{}, err
+	}
+
+	report.ResolvedAt = time.Now().Unix()
+	report.Resolution = resolution
+	_, err = tx.Exec("UPDATE reports SET resolved_at = ?, resolution = ? WHERE id = ?", report.ResolvedAt, report.Resolution, id)
+	if err != nil {
+		logError(ctx, "error resolving report", err)
+		return Report{}, err
+	}
+
+	switch resolution {
+	case ResolutionHidden:
+		_, err = tx.Exec("UPDATE videos SET status = ?, updated_at = ? WHERE id = ?", StatusHidden, report.ResolvedAt, report.VideoID)
+	case ResolutionDismissed:
+		var count int
+		count, err = countOpenReports(tx, report.VideoID)
+		if err == nil && (hideThreshold <= 0 || count < hideThreshold) {
+			_, err = tx.Exec("UPDATE videos SET status = ?, updated_at = ? WHERE id = ? AND status = ?", StatusActive, report.ResolvedAt, report.VideoID, StatusReported)
+		}
+	}
+	if err != nil {
+		logError(ctx, "error updating video status", err)
+		return Report{}, err
+	}
+	if after, err := getVideoTx(tx, report.VideoID); err == nil {
+		if err := recordRevisions(ctx, tx, before, after, RevisionAdmin); err != nil {
+			return Report{}, err
+		}
+	}
+	if err := writeAudit(ctx, tx, audit, AuditReportResolve, report.VideoID, open, report); err != nil {
+		return Report{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		logError(ctx, "error resolving report", err)
+		return Report{}, err
+	}
+	return report, nil
+}
+
+// returns sql.ErrNoRows when the video is not saved
+func SetVideoStatus(ctx context.Context, id string, status string, audit Audit) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		logError(ctx, "error starting transaction", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := setVideoStatus(ctx, tx, id, status, audit); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		logError(ctx, "error updating video status", err)
+		return err
+	}
+	return nil
+}
+
+// changes the status and audits it, returns sql.ErrNoRows when the video is not saved
+func setVideoStatus(ctx context.Context, tx *sql.Tx, id string, status string, audit Audit) error {
+	before, err := getVideoTx(tx, id)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logError(ctx, "error getting video", err)
+		}
+		return err
+	}
+	if before.DeletedAt != 0 {
+		return sql.ErrNoRows
+	}
+	if _, err := tx.Exec("UPDATE videos SET status = ?, updated_at = ? WHERE id = ?", status, time.Now().Unix(), id); err != nil {
+		logError(ctx, "error updating video status", err)
+		return err
+	}
+	after := before
+	after.Status = status
+	if err := recordRevisions(ctx, tx, before, after, RevisionAdmin); err != nil {
+		return err
+	}
+	return writeAudit(ctx, tx, audit, AuditVideoStatus, id, before, after)
+}
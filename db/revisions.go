@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+)
+
+// where a metadata change came from
+const (
+	RevisionRefresh = "refresh"
+	RevisionAdmin   = "admin"
+	RevisionImport  = "import"
+	RevisionReport  = "report"
+)
+
+type Revision struct {
+	ID        int64  `json:"id"`
+	VideoID   string `json:"video_id"`
+	Field     string `json:"field"`
+	OldValue  string `json:"old_value"`
+	NewValue  string `json:"new_value"`
+	ChangedAt int64  `json:"changed_at"`
+	Source    string `json:"source"`
+}
+
+type revisionField struct {
+	name  string
+	value func(Video) string
+}
+
+// the tracked fields, named like their json keys on Video
+var revisionFields = []revisionField{
+	{"video_name", func(v Video) string { return v.VideoName }},
+	{"video_author_name", func(v Video) string { return v.VideoAuthorName }},
+	{"is_embeddable", func(v Video) string { return strconv.FormatBool(v.IsEmbeddable) }},
+	{"channel_id", func(v Video) string { return v.ChannelID }},
+	{"status", func(v Video) string { return v.Status }},
+}
+
+// stores one revision per field that differs between before and after
+func recordRevisions(ctx context.Context, tx *sql.Tx, before Video, after Video, source string) error {
+	now := time.Now().Unix()
+	for _, field := range revisionFields {
+		old, value := field.value(before), field.value(after)
+		if old == value {
+			continue
+		}
+		_, err := tx.Exec("INSERT INTO video_revisions (video_id, field, old_value, new_value, changed_at, source) VALUES (?, ?, ?, ?, ?, ?)",
+			after.ID, field.name, old, value, now, source)
+		if err != nil {
+			logError(ctx, "error saving revision", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// changes of one video newest first
+func GetRevisions(ctx context.Context, videoID string, limit int, offset int) ([]Revision, error) {
+	rows, err := DB.Query(`SELECT id, video_id, field, old_value, new_value, changed_at, source FROM video_revisions
+		WHERE video_id = ? ORDER BY id DESC LIMIT ? OFFSET ?`, videoID, limit, offset)
+	if err != nil {
+		logError(ctx, "error getting revisions", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []Revision{}
+	for rows.Next() {
+		var rev Revision
+		if err := rows.Scan(&rev.ID, &rev.VideoID, &rev.Field, &rev.OldValue, &rev.NewValue, &rev.ChangedAt, &rev.Source); err != nil {
+			logError(ctx, "error scanning row", err)
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+	return revisions, rows.Err()
+}
@@ -0,0 +1,181 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+// FTS5 is only compiled into go-sqlite3 with the sqlite_fts5 build tag,
+// without it the server still runs and search answers with an error
+var SearchEnabled bool
+
+var ErrSearchDisabled = errors.New("full-text search is not available")
+
+// markers wrapped around matched terms in snippets, picked so they can't appear in titles
+const (
+	SnippetOpen  = "\x02"
+	SnippetClose = "\x03"
+)
+
+type SearchResult struct {
+	Video         Video
+	TitleSnippet  string
+	AuthorSnippet string
+	Rank          float64
+}
+
+var searchTriggers = []string{"videos_fts_insert", "videos_fts_delete", "videos_fts_update"}
+
+// creates the search index and the triggers keeping it in sync with videos
+// the index keeps its own copy of the text keyed by video id, rowids of videos are not stable across VACUUM
+func initSearch(db *sql.DB) {
+	var exists, triggers int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'videos_fts'").Scan(&exists)
+	if err == nil {
+		err = db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name IN (?, ?, ?)", searchTriggers[0], searchTriggers[1], searchTriggers[2]).Scan(&triggers)
+	}
+	if err != nil {
+		logError(context.Background(), "error checking search index", err)
+		return
+	}
+
+	// triggers left behind by a binary with FTS5 would make every write to videos fail here
+	var fts5 bool
+	if err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&fts5); err != nil || !fts5 {
+		dropSearchTriggers(db)
+		logInfo(context.Background(), "full-text search disabled, sqlite was built without FTS5")
+		return
+	}
+
+	stmts := []string{
+		"CREATE VIRTUAL TABLE IF NOT EXISTS videos_fts USING fts5(id UNINDEXED, video_name, video_author_username, tokenize = 'unicode61 remove_diacritics 2')",
+		`CREATE TRIGGER IF NOT EXISTS videos_fts_insert AFTER INSERT ON videos BEGIN
+			INSERT INTO videos_fts (id, video_name, video_author_username) VALUES (new.id, new.video_name, new.video_author_username);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS videos_fts_delete AFTER DELETE ON videos BEGIN
+			DELETE FROM videos_fts WHERE id = old.id;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS videos_fts_update AFTER UPDATE OF video_name, video_author_username ON videos BEGIN
+			UPDATE videos_fts SET video_name = new.video_name, video_author_username = new.video_author_username WHERE id = old.id;
+		END`,
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			logError(context.Background(), "full-text search disabled", err)
+			dropSearchTriggers(db)
+			return
+		}
+	}
+	SearchEnabled = true
+
+	// an index without all of its triggers missed the writes made while search was disabled
+	if exists == 0 || triggers < len(searchTriggers) {
+		logInfo(context.Background(), "search index created or stale, backfilling existing videos")
+		if err := rebuildSearchIndex(db); err != nil {
+			logError(context.Background(), "error backfilling search index", err)
+		}
+	}
+}
+
+func dropSearchTriggers(db *sql.DB) {
+	for _, name := range searchTriggers {
+		if _, err := db.Exec("DROP TRIGGER IF EXISTS " + name); err != nil {
+			logError(context.Background(), "error dropping search trigger", err, "trigger", name)
+		}
+	}
+}
+
+func rebuildSearchIndex(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM videos_fts"); err != nil {
+		return err
+	}
+	res, err := tx.Exec("INSERT INTO videos_fts (id, video_name, video_author_username) SELECT id, video_name, video_author_username FROM videos")
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	n, _ := res.RowsAffected()
+	logInfo(context.Background(), "search index rebuilt", "videos", n)
+	return nil
+}
+
+// drops and refills the search index from the videos table
+func RebuildSearchIndex() error {
+	if !SearchEnabled {
+		return ErrSearchDisabled
+	}
+	return rebuildSearchIndex(DB)
+}
+
+// turns user input into an FTS5 query: every word is quoted so operators are never parsed,
+// the last one is a prefix match so results show up while typing
+func buildMatchQuery(input string) string {
+	words := strings.Fields(input)
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		word = strings.ReplaceAll(word, `"`, "")
+		if word == "" {
+			continue
+		}
+		terms = append(terms, `"`+word+`"`)
+	}
+	if len(terms) == 0 {
+		return ""
+	}
+	terms[len(terms)-1] += "*"
+	return strings.Join(terms, " ")
+}
+
+// ranks matches with bm25, a hit in the title weighs more than a hit in the channel name
+func SearchVideos(ctx context.Context, input string, limit int, offset int) ([]SearchResult, error) {
+	defer observe("search_videos")()
+	if !SearchEnabled {
+		return nil, ErrSearchDisabled
+	}
+	match := buildMatchQuery(input)
+	if match == "" {
+		return []SearchResult{}, nil
+	}
+
+	stmt, err := DB.Prepare(`SELECT ` + videoColumns + `,
+		snippet(videos_fts, 1, ?, ?, '…', 16),
+		snippet(videos_fts, 2, ?, ?, '…', 16),
+		bm25(videos_fts, 0.0, 10.0, 3.0) AS score
+		FROM videos_fts JOIN videos v ON v.id = videos_fts.id LEFT JOIN channels c ON c.id = v.channel_id
+		WHERE videos_fts MATCH ? AND ` + visibleVideo + `
+		ORDER BY score LIMIT ? OFFSET ?`)
+	if err != nil {
+		logError(ctx, "error preparing statement", err)
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(SnippetOpen, SnippetClose, SnippetOpen, SnippetClose, match, limit, offset)
+	if err != nil {
+		logError(ctx, "error searching videos", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []SearchResult{}
+	for rows.Next() {
+		var result SearchResult
+		err = scanVideo(rows, &result.Video, &result.TitleSnippet, &result.AuthorSnippet, &result.Rank)
+		if err != nil {
+			logError(ctx, "error scanning row", err)
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
@@ -0,0 +1,26 @@
+package db
+
+import "testing"
+
+func TestBuildMatchQuery(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"", ""},
+		{"   ", ""},
+		{"cat", `"cat"*`},
+		{"funny cat", `"funny" "cat"*`},
+		{"  funny   cat  ", `"funny" "cat"*`},
+		{`say "hi"`, `"say" "hi"*`},
+		{`""`, ""},
+		{"cat OR dog", `"cat" "OR" "dog"*`},
+		{"NEAR(a b) -c", `"NEAR(a" "b)" "-c"*`},
+		{"café", `"café"*`},
+	}
+	for _, tt := range tests {
+		if got := buildMatchQuery(tt.input); got != tt.want {
+			t.Errorf("buildMatchQuery(%q) = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
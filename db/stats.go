@@ -0,0 +1,124 @@
+package db
+
+import (
+	"context"
+)
+
+// layout of the day column, days are UTC
+const StatsDayLayout = "2006-01-02"
+
+type StatKey struct {
+	VideoID string
+	Day     string
+}
+
+type StatCounts struct {
+	Impressions int64 `json:"impressions"`
+	Plays       int64 `json:"plays"`
+}
+
+type DayStats struct {
+	Day string `json:"day"`
+	StatCounts
+}
+
+type VideoStats struct {
+	VideoID string `json:"id"`
+	StatCounts
+}
+
+// adds a batch of counters in one transaction
+func AddStats(batch map[StatKey]StatCounts) error {
+	defer observe("add_stats")()
+	tx, err := DB.Begin()
+	if err != nil {
+		logError(context.Background(), "error starting transaction", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT INTO video_stats (video_id, day, impressions, plays) VALUES (?, ?, ?, ?)
+		ON CONFLICT(video_id, day) DO UPDATE SET impressions = impressions + excluded.impressions, plays = plays + excluded.plays`)
+	if err != nil {
+		logError(context.Background(), "error preparing statement", err)
+		return err
+	}
+	defer stmt.Close()
+
+	for key, counts := range batch {
+		if _, err := stmt.Exec(key.VideoID, key.Day, counts.Impressions, counts.Plays); err != nil {
+			logError(context.Background(), "error saving stats", err)
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		logError(context.Background(), "error saving stats", err)
+		return err
+	}
+	return nil
+}
+
+// totals per day over the whole catalog, from sinceDay on
+func GetDailyStats(ctx context.Context, sinceDay string) ([]DayStats, error) {
+	rows, err := DB.Query("SELECT day, SUM(impressions), SUM(plays) FROM video_stats WHERE day >= ? GROUP BY day ORDER BY day ASC", sinceDay)
+	if err != nil {
+		logError(ctx, "error getting stats", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := []DayStats{}
+	for rows.Next() {
+		var day DayStats
+		if err := rows.Scan(&day.Day, &day.Impressions, &day.Plays); err != nil {
+			logError(ctx, "error scanning row", err)
+			return nil, err
+		}
+		days = append(days, day)
+	}
+	return days, rows.Err()
+}
+
+// counters of one video per day, from sinceDay on
+func GetVideoDailyStats(ctx context.Context, videoID string, sinceDay string) ([]DayStats, error) {
+	rows, err := DB.Query("SELECT day, impressions, plays FROM video_stats WHERE video_id = ? AND day >= ? ORDER BY day ASC", videoID, sinceDay)
+	if err != nil {
+		logError(ctx, "error getting video stats", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := []DayStats{}
+	for rows.Next() {
+		var day DayStats
+		if err := rows.Scan(&day.Day, &day.Impressions, &day.Plays); err != nil {
+			logError(ctx, "error scanning row", err)
+			return nil, err
+		}
+		days = append(days, day)
+	}
+	return days, rows.Err()
+}
+
+// most played videos from sinceDay on, deleted videos left out
+func GetTopPlayed(ctx context.Context, sinceDay string, limit int) ([]VideoStats, error) {
+	rows, err := DB.Query(`SELECT video_id, SUM(impressions), SUM(plays) FROM video_stats
+		WHERE day >= ? AND video_id NOT IN (SELECT id FROM videos WHERE deleted_at IS NOT NULL)
+		GROUP BY video_id ORDER BY SUM(plays) DESC, SUM(impressions) DESC, video_id ASC LIMIT ?`, sinceDay, limit)
+	if err != nil {
+		logError(ctx, "error getting top played videos", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	videos := []VideoStats{}
+	for rows.Next() {
+		var video VideoStats
+		if err := rows.Scan(&video.VideoID, &video.Impressions, &video.Plays); err != nil {
+			logError(ctx, "error scanning row", err)
+			return nil, err
+		}
+		videos = append(videos, video)
+	}
+	return videos, rows.Err()
+}
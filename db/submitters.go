@@ -0,0 +1,51 @@
+package db
+
+import (
+	"context"
+)
+
+type Submitter struct {
+	ID       string `json:"id"`
+	Videos   int    `json:"videos"`
+	Likes    int    `json:"likes"`
+	Dislikes int    `json:"dislikes"`
+	Score    int    `json:"score"`
+}
+
+// sort keys accepted by ListSubmitters
+const (
+	SubmitterSortVideos = "videos"
+	SubmitterSortVotes  = "votes"
+)
+
+// leaderboard of submitters by visible videos or by the votes their videos received
+func ListSubmitters(ctx context.Context, sort string, limit int, offset int) ([]Submitter, error) {
+	order := "videos DESC, score DESC"
+	if sort == SubmitterSortVotes {
+		order = "score DESC, likes DESC, videos DESC"
+	}
+	rows, err := DB.Query(`SELECT v.submitter, COUNT(*) AS videos, COALESCE(SUM(s.likes), 0) AS likes, COALESCE(SUM(s.dislikes), 0) AS dislikes,
+		COALESCE(SUM(s.likes), 0) - COALESCE(SUM(s.dislikes), 0) AS score
+		FROM videos v LEFT JOIN (
+			SELECT video_id, COUNT(CASE WHEN value > 0 THEN 1 END) AS likes, COUNT(CASE WHEN value < 0 THEN 1 END) AS dislikes
+			FROM votes GROUP BY video_id
+		) s ON s.video_id = v.id
+		WHERE v.submitter != '' AND `+visibleVideo+`
+		GROUP BY v.submitter ORDER BY `+order+`, v.submitter ASC LIMIT ? OFFSET ?`, limit, offset)
+	if err != nil {
+		logError(ctx, "error listing submitters", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	submitters := []Submitter{}
+	for rows.Next() {
+		var submitter Submitter
+		if err := rows.Scan(&submitter.ID, &submitter.Videos, &submitter.Likes, &submitter.Dislikes, &submitter.Score); err != nil {
+			logError(ctx, "error scanning row", err)
+			return nil, err
+		}
+		submitters = append(submitters, submitter)
+	}
+	return submitters, rows.Err()
+}
@@ -0,0 +1,136 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type VoteScore struct {
+	Likes       int   `json:"likes"`
+	Dislikes    int   `json:"dislikes"`
+	Score       int   `json:"score"`
+	LastVotedAt int64 `json:"-"`
+}
+
+type RatedVideo struct {
+	Video Video
+	Votes VoteScore
+}
+
+// the vote as the audit log records it
+type auditVote struct {
+	Voter string `json:"voter"`
+	Value int    `json:"value"`
+}
+
+// one vote per voter and video, value is 1 or -1; 0 takes the vote back
+func SetVote(ctx context.Context, videoID string, voter string, value int, audit Audit) error {
+	defer observe("set_vote")()
+	tx, err := DB.Begin()
+	if err != nil {
+		logError(ctx, "error starting transaction", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	var previous int
+	err = tx.QueryRow("SELECT value FROM votes WHERE video_id = ? AND voter = ?", videoID, voter).Scan(&previous)
+	if err != nil && err != sql.ErrNoRows {
+		logError(ctx, "error getting vote", err)
+		return err
+	}
+	if value == 0 {
+		_, err = tx.Exec("DELETE FROM votes WHERE video_id = ? AND voter = ?", videoID, voter)
+	} else {
+		_, err = tx.Exec(`INSERT INTO votes (video_id, voter, value, voted_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT(video_id, voter) DO UPDATE SET value = excluded.value, voted_at = excluded.voted_at`,
+			videoID, voter, value, time.Now().Unix())
+	}
+	if err != nil {
+		logError(ctx, "error saving vote", err)
+		return err
+	}
+
+	var before, after any
+	if previous != 0 {
+		before = auditVote{Voter: voter, Value: previous}
+	}
+	if value != 0 {
+		after = auditVote{Voter: voter, Value: value}
+	}
+	if err := writeAudit(ctx, tx, audit, AuditVoteSet, videoID, before, after); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		logError(ctx, "error saving vote", err)
+		return err
+	}
+	return nil
+}
+
+// returns the vote of voter on the video, 0 when there is none
+func GetVote(ctx context.Context, videoID string, voter string) (int, error) {
+	var value int
+	err := DB.QueryRow("SELECT value FROM votes WHERE video_id = ? AND voter = ?", videoID, voter).Scan(&value)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		logError(ctx, "error getting vote", err)
+	}
+	return value, err
+}
+
+func GetVoteScore(ctx context.Context, videoID string) (VoteScore, error) {
+	defer observe("get_vote_score")()
+	var score VoteScore
+	err := DB.QueryRow(`SELECT COUNT(CASE WHEN value > 0 THEN 1 END), COUNT(CASE WHEN value < 0 THEN 1 END), COALESCE(MAX(voted_at), 0)
+		FROM votes WHERE video_id = ?`, videoID).
+		Scan(&score.Likes, &score.Dislikes, &score.LastVotedAt)
+	if err != nil {
+		logError(ctx, "error getting vote score", err)
+		return VoteScore{}, err
+	}
+	score.Score = score.Likes - score.Dislikes
+	return score, nil
+}
+
+// best rated videos counting only votes cast after since (unix time, 0 for all time)
+func TopVideos(ctx context.Context, since int64, limit int) ([]RatedVideo, error) {
+	defer observe("top_videos")()
+	stmt, err := DB.Prepare(`SELECT ` + videoColumns + `,
+		t.likes, t.dislikes, t.last_voted_at
+		FROM (
+			SELECT video_id, COUNT(CASE WHEN value > 0 THEN 1 END) AS likes, COUNT(CASE WHEN value < 0 THEN 1 END) AS dislikes, MAX(voted_at) AS last_voted_at
+			FROM votes WHERE voted_at >= ? GROUP BY video_id
+		) t
+		JOIN videos v ON v.id = t.video_id LEFT JOIN channels c ON c.id = v.channel_id
+		WHERE ` + visibleVideo + `
+		ORDER BY t.likes - t.dislikes DESC, t.likes DESC, v.id ASC LIMIT ?`)
+	if err != nil {
+		logError(ctx, "error preparing statement", err)
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(since, limit)
+	if err != nil {
+		logError(ctx, "error getting top videos", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	videos := []RatedVideo{}
+	for rows.Next() {
+		var rated RatedVideo
+		err = scanVideo(rows, &rated.Video, &rated.Votes.Likes, &rated.Votes.Dislikes, &rated.Votes.LastVotedAt)
+		if err != nil {
+			logError(ctx, "error scanning row", err)
+			return nil, err
+		}
+		rated.Votes.Score = rated.Votes.Likes - rated.Votes.Dislikes
+		videos = append(videos, rated)
+	}
+	return videos, rows.Err()
+}
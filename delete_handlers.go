@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"go3/db"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+type DeletedVideoResponse struct {
+	VideoDetailResponse
+	DeletedAt int64 `json:"deleted_at"`
+}
+
+type DeletedVideoListResponse struct {
+	Videos []DeletedVideoResponse `json:"videos"`
+	Offset int                    `json:"offset"`
+}
+
+func handleAdminDeleteVideo(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	err := db.DeleteVideo(r.Context(), id, adminAudit(r))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Video not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to delete video", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+	slog.InfoContext(r.Context(), "admin: video deleted", "id", id)
+}
+
+func handleAdminRestoreVideo(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	err := db.RestoreVideo(r.Context(), id, adminAudit(r))
+	if err == sql.ErrNoRows {
+		http.Error(w, "No deleted video with that id", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to restore video", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+	slog.InfoContext(r.Context(), "admin: video restored", "id", id)
+}
+
+func handleAdminDeletedVideos(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parseLimitOffset(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	videos, err := db.ListDeletedVideos(r.Context(), limit, offset)
+	if err != nil {
+		http.Error(w, "Failed to list deleted videos", http.StatusInternalServerError)
+		return
+	}
+	response := DeletedVideoListResponse{
+		Videos: make([]DeletedVideoResponse, 0, len(videos)),
+		Offset: offset,
+	}
+	for _, video := range videos {
+		response.Videos = append(response.Videos, DeletedVideoResponse{
+			VideoDetailResponse: newVideoDetailResponse(video, ""),
+			DeletedAt:           video.DeletedAt,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// --undelete takes a video id or "all"
+func undeleteVideos(ctx context.Context, target string, audit db.Audit) {
+	if target == "all" {
+		n, err := db.RestoreAllVideos(ctx, audit)
+		if err != nil {
+			slog.ErrorContext(ctx, "error restoring videos", "err", err)
+			return
+		}
+		slog.InfoContext(ctx, "restored videos", "count", n)
+		return
+	}
+	err := db.RestoreVideo(ctx, target, audit)
+	if err == sql.ErrNoRows {
+		slog.InfoContext(ctx, "no deleted video with id", "id", target)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "error restoring video", "err", err)
+		return
+	}
+	slog.InfoContext(ctx, "restored", "id", target)
+}
+
+// --purge-deleted removes videos deleted more than days ago for good, 0 purges every deleted video
+func purgeDeletedVideos(ctx context.Context, days int, audit db.Audit) {
+	cutoff := time.Now().AddDate(0, 0, -days).Unix()
+	if days == 0 {
+		// deleted_at < cutoff, so this also takes videos deleted within the current second
+		cutoff++
+	}
+	n, err := db.PurgeDeletedVideos(ctx, cutoff, audit)
+	if err != nil {
+		slog.ErrorContext(ctx, "error purging deleted videos", "err", err)
+		return
+	}
+	slog.InfoContext(ctx, "purged deleted videos", "count", n, "older_than_days", days)
+}
@@ -3,6 +3,7 @@ package env
 import (
 	"log"
 	"os"
+	"strconv"
 
 	"github.com/joho/godotenv"
 )
@@ -13,6 +14,15 @@ func (key EnvKey) Get() string {
 	return os.Getenv(string(key))
 }
 
+// returns the value as an int, def when it is unset or not a number
+func (key EnvKey) Int(def int) int {
+	n, err := strconv.Atoi(key.Get())
+	if err != nil {
+		return def
+	}
+	return n
+}
+
 func LoadEnv() {
 	err := godotenv.Load()
 	if err != nil {
@@ -34,4 +44,32 @@ const (
 	AllowedMethods EnvKey = "ALLOWED_METHODS"
 	DBPath         EnvKey = "DB_PATH"
 	YTDataAPIv3Key EnvKey = "YT_DATA_API_V3_KEY"
+	IPHashSecret   EnvKey = "IP_HASH_SECRET"
+	AdminToken     EnvKey = "ADMIN_TOKEN"
+	ReportHideAt   EnvKey = "REPORT_HIDE_THRESHOLD"
+	ReportRate     EnvKey = "REPORTS_PER_HOUR"
+	StatsFlushSecs EnvKey = "STATS_FLUSH_SECONDS"
+	IPRetention    EnvKey = "IP_RETENTION_DAYS"
+	PowEnabled     EnvKey = "POW_ENABLED"
+	PowDifficulty  EnvKey = "POW_DIFFICULTY"
+	PowSecret      EnvKey = "POW_SECRET"
+	BackupDir      EnvKey = "BACKUP_DIR"
+	BackupInterval EnvKey = "BACKUP_INTERVAL_HOURS"
+	BackupKeep     EnvKey = "BACKUP_KEEP"
+	ShutdownSecs   EnvKey = "SHUTDOWN_TIMEOUT_SECONDS"
+	YTDailyQuota   EnvKey = "YT_DAILY_QUOTA"
+	ReadyNeedsYT   EnvKey = "READY_REQUIRES_YOUTUBE"
+	MetricsToken   EnvKey = "METRICS_TOKEN"
+	LogFormat      EnvKey = "LOG_FORMAT"
+	LogLevel       EnvKey = "LOG_LEVEL"
+	TrustedProxies EnvKey = "TRUSTED_PROXIES"
+	ImportMaxMB    EnvKey = "IMPORT_MAX_MB"
+
+	AccessLogFormat  EnvKey = "ACCESS_LOG_FORMAT"
+	AccessLogFile    EnvKey = "ACCESS_LOG_FILE"
+	AccessLogMaxMB   EnvKey = "ACCESS_LOG_MAX_MB"
+	AccessLogKeep    EnvKey = "ACCESS_LOG_KEEP"
+	AccessLogExclude EnvKey = "ACCESS_LOG_EXCLUDE"
+	AccessLogSample  EnvKey = "ACCESS_LOG_SAMPLE"
+	AccessLogHealth  EnvKey = "ACCESS_LOG_HEALTH"
 )
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go3/db"
+	"go3/env"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// catalog file formats, every one carries all db.Video fields
+const (
+	formatJSON   = "json"
+	formatCSV    = "csv"
+	formatNDJSON = "ndjson"
+)
+
+var csvHeader = []string{"id", "video_name", "video_author_name", "is_embeddable", "added_at", "added_from_ip", "channel_id", "status", "submitter", "updated_at"}
+
+func isValidFormat(format string) bool {
+	return format == formatJSON || format == formatCSV || format == formatNDJSON
+}
+
+// the format flag wins, otherwise the file extension decides
+func formatFor(path string, format string) (string, error) {
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+	if !isValidFormat(format) {
+		return "", fmt.Errorf("unknown format '%s', use json, csv or ndjson", format)
+	}
+	return format, nil
+}
+
+func videoCSVRecord(video db.Video) []string {
+	return []string{
+		video.ID,
+		video.VideoName,
+		video.VideoAuthorName,
+		strconv.FormatBool(video.IsEmbeddable),
+		strconv.FormatInt(video.AddedAt, 10),
+		video.AddedFromIP,
+		video.ChannelID,
+		video.Status,
+		video.Submitter,
+		strconv.FormatInt(video.UpdatedAt, 10),
+	}
+}
+
+// columns are matched by header name so files with reordered or missing columns still load
+func parseCSVRecord(columns map[string]int, record []string) (db.Video, error) {
+	get := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+	video := db.Video{
+		ID:              get("id"),
+		VideoName:       get("video_name"),
+		VideoAuthorName: get("video_author_name"),
+		AddedFromIP:     get("added_from_ip"),
+		ChannelID:       get("channel_id"),
+		Status:          get("status"),
+		Submitter:       get("submitter"),
+	}
+	var err error
+	if raw := get("is_embeddable"); raw != "" {
+		if video.IsEmbeddable, err = strconv.ParseBool(raw); err != nil {
+			return video, fmt.Errorf("invalid is_embeddable '%s'", raw)
+		}
+	}
+	if raw := get("added_at"); raw != "" {
+		if video.AddedAt, err = strconv.ParseInt(raw, 10, 64); err != nil {
+			return video, fmt.Errorf("invalid added_at '%s'", raw)
+		}
+	}
+	if raw := get("updated_at"); raw != "" {
+		if video.UpdatedAt, err = strconv.ParseInt(raw, 10, 64); err != nil {
+			return video, fmt.Errorf("invalid updated_at '%s'", raw)
+		}
+	}
+	return video, nil
+}
+
+// streams the catalog to w, returns how many videos were written
+func exportVideos(ctx context.Context, w io.Writer, format string) (int, error) {
+	count := 0
+	switch format {
+	case formatCSV:
+		out := csv.NewWriter(w)
+		out.Write(csvHeader)
+		err := db.EachVideo(ctx, func(video db.Video) error {
+			count++
+			return out.Write(videoCSVRecord(video))
+		})
+		out.Flush()
+		if err == nil {
+			err = out.Error()
+		}
+		return count, err
+	case formatNDJSON:
+		enc := json.NewEncoder(w)
+		err := db.EachVideo(ctx, func(video db.Video) error {
+			count++
+			return enc.Encode(video)
+		})
+		return count, err
+	default:
+		// written element by element so the array never has to fit in memory
+		if _, err := io.WriteString(w, "[\n"); err != nil {
+			return 0, err
+		}
+		err := db.EachVideo(ctx, func(video db.Video) error {
+			data, err := json.Marshal(video)
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				if _, err := io.WriteString(w, ",\n"); err != nil {
+					return err
+				}
+			}
+			count++
+			_, err = w.Write(data)
+			return err
+		})
+		if err != nil {
+			return count, err
+		}
+		_, err = io.WriteString(w, "\n]\n")
+		return count, err
+	}
+}
+
+// reads videos from r one at a time and hands them to fn
+func readVideos(r io.Reader, format string, fn func(db.Video) error) error {
+	switch format {
+	case formatCSV:
+		in := csv.NewReader(r)
+		header, err := in.Read()
+		if err != nil {
+			return fmt.Errorf("reading header: %w", err)
+		}
+		columns := make(map[string]int, len(header))
+		for i, name := range header {
+			columns[strings.TrimSpace(name)] = i
+		}
+		if _, ok := columns["id"]; !ok {
+			return errors.New("header has no 'id' column")
+		}
+		for line := 2; ; line++ {
+			record, err := in.Read()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			video, err := parseCSVRecord(columns, record)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", line, err)
+			}
+			if err := fn(video); err != nil {
+				return fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+	case formatNDJSON:
+		dec := json.NewDecoder(r)
+		for n := 1; ; n++ {
+			var video db.Video
+			err := dec.Decode(&video)
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("record %d: %w", n, err)
+			}
+			if err := fn(video); err != nil {
+				return fmt.Errorf("record %d: %w", n, err)
+			}
+		}
+	default:
+		dec := json.NewDecoder(r)
+		if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+			return errors.New("expected a JSON array of videos")
+		}
+		for n := 1; dec.More(); n++ {
+			var video db.Video
+			if err := dec.Decode(&video); err != nil {
+				return fmt.Errorf("record %d: %w", n, err)
+			}
+			if err := fn(video); err != nil {
+				return fmt.Errorf("record %d: %w", n, err)
+			}
+		}
+		_, err := dec.Token()
+		return err
+	}
+}
+
+// imports in batches: a bad record stops the import, the batches before it stay saved
+// the returned summary counts the saved videos also when there is an error
+func importVideos(ctx context.Context, r io.Reader, format string, policy string, audit db.Audit) (db.ImportSummary, error) {
+	importer := db.NewImporter(ctx, policy, audit)
+	batch := make([]db.Video, 0, db.ImportBatchSize)
+	err := readVideos(r, format, func(video db.Video) error {
+		if !isValidID(video.ID) {
+			return fmt.Errorf("invalid id '%s'", video.ID)
+		}
+		if video.Status != "" && !db.IsValidStatus(video.Status) {
+			return fmt.Errorf("invalid status '%s'", video.Status)
+		}
+		batch = append(batch, video)
+		if len(batch) < db.ImportBatchSize {
+			return nil
+		}
+		err := importer.AddBatch(batch)
+		batch = batch[:0]
+		return err
+	})
+	if err == nil && len(batch) > 0 {
+		err = importer.AddBatch(batch)
+	}
+	if err != nil {
+		return importer.Summary, err
+	}
+	importer.Done()
+	return importer.Summary, nil
+}
+
+// --export <path>
+func exportToFile(ctx context.Context, path string, format string) {
+	format, err := formatFor(path, format)
+	if err != nil {
+		slog.ErrorContext(ctx, "error exporting videos", "err", err)
+		return
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		slog.ErrorContext(ctx, "error exporting videos", "err", err)
+		return
+	}
+	defer file.Close()
+
+	out := bufio.NewWriter(file)
+	count, err := exportVideos(ctx, out, format)
+	if err == nil {
+		err = out.Flush()
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "error exporting videos", "err", err)
+		return
+	}
+	slog.InfoContext(ctx, "exported videos", "count", count, "path", path)
+}
+
+// --import <path>
+func importFromFile(ctx context.Context, path string, format string, policy string, audit db.Audit) {
+	format, err := formatFor(path, format)
+	if err != nil {
+		slog.ErrorContext(ctx, "error importing videos", "err", err)
+		return
+	}
+	if !db.IsValidImportPolicy(policy) {
+		slog.ErrorContext(ctx, "error importing videos: --on-conflict must be one of skip, overwrite, newer")
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		slog.ErrorContext(ctx, "error importing videos", "err", err)
+		return
+	}
+	defer file.Close()
+
+	summary, err := importVideos(ctx, bufio.NewReader(file), format, policy, audit)
+	if err != nil {
+		slog.ErrorContext(ctx, "error importing videos", "err", err, "saved", summary.Total())
+		return
+	}
+	slog.InfoContext(ctx, "imported videos", "path", path, "inserted", summary.Inserted, "updated", summary.Updated, "skipped", summary.Skipped)
+}
+
+var formatContentTypes = map[string]string{
+	formatJSON:   "application/json",
+	formatCSV:    "text/csv",
+	formatNDJSON: "application/x-ndjson",
+}
+
+// format=json|csv|ndjson, defaults to ndjson
+func handleAdminExport(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = formatNDJSON
+	}
+	if !isValidFormat(format) {
+		http.Error(w, "'format' must be one of json, csv, ndjson", http.StatusBadRequest)
+		return
+	}
+	extendDeadlines(w, r)
+	name := fmt.Sprintf("videos-%s.%s", time.Now().UTC().Format(backupTimeFormat), format)
+	w.Header().Set("Content-Type", formatContentTypes[format])
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	count, err := exportVideos(r.Context(), w, format)
+	if err != nil {
+		// headers are gone already, the client sees a truncated file
+		slog.ErrorContext(r.Context(), "error exporting videos", "err", err)
+		return
+	}
+	slog.InfoContext(r.Context(), "admin: exported videos", "count", count, "format", format)
+}
+
+// the body is the file; format=json|csv|ndjson (defaults to ndjson), on_conflict=skip|overwrite|newer (defaults to skip)
+func handleAdminImport(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	format := params.Get("format")
+	if format == "" {
+		format = formatNDJSON
+	}
+	if !isValidFormat(format) {
+		http.Error(w, "'format' must be one of json, csv, ndjson", http.StatusBadRequest)
+		return
+	}
+	policy := params.Get("on_conflict")
+	if policy == "" {
+		policy = db.ImportSkip
+	}
+	if !db.IsValidImportPolicy(policy) {
+		http.Error(w, "'on_conflict' must be one of skip, overwrite, newer", http.StatusBadRequest)
+		return
+	}
+
+	extendDeadlines(w, r)
+	body := http.MaxBytesReader(w, r.Body, int64(env.ImportMaxMB.Int(64))<<20)
+	summary, err := importVideos(r.Context(), body, format, policy, adminAudit(r))
+	if err != nil {
+		status := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, fmt.Sprintf("Import failed after saving %d videos: %s", summary.Total(), err), status)
+		slog.ErrorContext(r.Context(), "admin: import failed", "err", err, "saved", summary.Total())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+	slog.InfoContext(r.Context(), "admin: imported videos", "format", format, "inserted", summary.Inserted, "updated", summary.Updated, "skipped", summary.Skipped)
+}
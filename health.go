@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"go3/db"
+	"go3/env"
+	"net/http"
+	"runtime/debug"
+)
+
+// readiness check results
+const (
+	checkOK          = "ok"
+	checkFailed      = "failed"
+	checkMissing     = "missing"
+	checkExhausted   = "exhausted"
+	checkOutOfDate   = "out of date"
+	readyStatusOK    = "ok"
+	readyStatusNotOK = "unavailable"
+)
+
+type ReadyResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+	Quota  QuotaResponse     `json:"youtube_quota"`
+}
+
+type QuotaResponse struct {
+	Used      int  `json:"used"`
+	Limit     int  `json:"limit"`
+	Exhausted bool `json:"exhausted"`
+}
+
+type VersionResponse struct {
+	Version             string `json:"version"`
+	GoVersion           string `json:"go_version"`
+	Revision            string `json:"revision,omitempty"`
+	RevisionTime        string `json:"revision_time,omitempty"`
+	Modified            bool   `json:"modified,omitempty"`
+	SchemaVersion       int    `json:"schema_version"`
+	LatestSchemaVersion int    `json:"latest_schema_version"`
+	Videos              int    `json:"videos"`
+}
+
+// the process is up, nothing else is checked so a slow db never gets it restarted
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte("ok\n"))
+}
+
+// ready when the db answers and every migration ran
+// the YouTube key and quota only count with READY_REQUIRES_YOUTUBE=TRUE, without them /v2/add fails but the rest works
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	response := ReadyResponse{Status: readyStatusOK, Checks: make(map[string]string)}
+	fail := func(check string, result string) {
+		response.Checks[check] = result
+		response.Status = readyStatusNotOK
+	}
+
+	response.Checks["db"] = checkOK
+	response.Checks["schema"] = checkOK
+	if err := db.DB.PingContext(r.Context()); err != nil {
+		fail("db", checkFailed)
+		fail("schema", checkFailed)
+	} else if version, err := db.SchemaVersion(); err != nil {
+		fail("schema", checkFailed)
+	} else if version != db.LatestSchemaVersion() {
+		fail("schema", checkOutOfDate)
+	}
+
+	requireYT := env.ReadyNeedsYT.Get() == "TRUE"
+	youtube := func(check string, ok bool, result string) {
+		switch {
+		case ok:
+			response.Checks[check] = checkOK
+		case requireYT:
+			fail(check, result)
+		default:
+			response.Checks[check] = result
+		}
+	}
+	used, limit, exhausted := ytQuota.State()
+	response.Quota = QuotaResponse{Used: used, Limit: limit, Exhausted: exhausted}
+	youtube("youtube_key", env.YTDataAPIv3Key.Get() != "", checkMissing)
+	youtube("youtube_quota", !exhausted, checkExhausted)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if response.Status != readyStatusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func handleVersion(w http.ResponseWriter, r *http.Request) {
+	response := VersionResponse{LatestSchemaVersion: db.LatestSchemaVersion()}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		response.Version = info.Main.Version
+		response.GoVersion = info.GoVersion
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				response.Revision = setting.Value
+			case "vcs.time":
+				response.RevisionTime = setting.Value
+			case "vcs.modified":
+				response.Modified = setting.Value == "true"
+			}
+		}
+	}
+	if version, err := db.SchemaVersion(); err == nil {
+		response.SchemaVersion = version
+	}
+	if count, err := db.CountSavedVideos(r.Context()); err == nil {
+		response.Videos = count
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"go3/env"
+	"go3/logging"
+	"log/slog"
+	"net/http"
+	"os"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// LOG_FORMAT is text or json, LOG_LEVEL one of debug, info, warn, error
+func setupLogging() {
+	logging.Setup(os.Stderr, env.LogFormat.Get(), env.LogLevel.Get())
+}
+
+// gives every request an id, it is echoed back and ends up in each line logged while serving it
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := logging.NewRequestID()
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
+
+// logs why a request was turned away, args are extra key/value pairs
+func logReject(r *http.Request, reason string, args ...any) {
+	slog.InfoContext(r.Context(), "rejected", append([]any{"path", r.URL.Path, "reason", reason}, args...)...)
+}
+
+// like log.Fatal
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
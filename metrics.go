@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"go3/db"
+	"go3/env"
+	"go3/metrics"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	httpRequests = metrics.NewCounterVec("http_requests_total", "Requests served by route, method and status.", "route", "method", "status")
+	httpDuration = metrics.NewHistogramVec("http_request_duration_seconds", "Request latency by route and method.", metrics.DefaultBuckets, "route", "method")
+
+	ytCalls      = metrics.NewCounterVec("youtube_api_calls_total", "YouTube Data API calls by endpoint and result.", "endpoint", "result")
+	ytDuration   = metrics.NewHistogramVec("youtube_api_call_duration_seconds", "YouTube Data API latency by endpoint.", metrics.DefaultBuckets, "endpoint")
+	ytQuotaUnits = metrics.NewCounterVec("youtube_quota_units_total", "Estimated YouTube quota units spent since start.", "endpoint")
+
+	cacheRequests = metrics.NewCounterVec("cache_requests_total", "Cache lookups by cache and result.", "cache", "result")
+)
+
+func init() {
+	metrics.NewGaugeFunc("youtube_quota_units_today", "Estimated YouTube quota units spent today (Pacific time).", "", func() map[string]float64 {
+		used, _, _ := ytQuota.State()
+		return map[string]float64{"": float64(used)}
+	})
+	metrics.NewGaugeFunc("youtube_quota_limit", "Daily YouTube quota from YT_DAILY_QUOTA.", "", func() map[string]float64 {
+		return map[string]float64{"": float64(ytDailyQuota())}
+	})
+	metrics.NewGaugeFunc("catalog_videos", "Saved videos by status.", "status", func() map[string]float64 {
+		counts, err := db.CountVideosByStatus(context.Background())
+		if err != nil {
+			return nil
+		}
+		values := map[string]float64{db.StatusActive: 0, db.StatusReported: 0, db.StatusHidden: 0}
+		for status, count := range counts {
+			values[status] = float64(count)
+		}
+		return values
+	})
+}
+
+// records hit or miss for one of the caches
+func cacheLookup(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	cacheRequests.Inc(cache, result)
+}
+
+// statusRecorder remembers what a handler wrote so middleware can report it
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += int64(n)
+	return n, err
+}
+
+// lets http.ResponseController reach Flush on the real writer
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// the pattern the mux matched without its method, so ids don't blow up the label count
+func routeLabel(r *http.Request) string {
+	if r.Pattern == "" {
+		return "unmatched"
+	}
+	if _, path, ok := strings.Cut(r.Pattern, " "); ok {
+		return path
+	}
+	return r.Pattern
+}
+
+// counts and times every request, the route is known once the mux picked a handler
+func instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		route := routeLabel(r)
+		httpRequests.Inc(route, r.Method, strconv.Itoa(rec.status))
+		httpDuration.Since(start, route, r.Method)
+	})
+}
+
+// open unless METRICS_TOKEN is set, then it wants that bearer token
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if token := env.MetricsToken.Get(); token != "" {
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	metrics.WriteTo(w)
+}
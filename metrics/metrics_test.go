@@ -0,0 +1,23 @@
+package metrics
+
+import "testing"
+
+func TestFormatLabels(t *testing.T) {
+	tests := []struct {
+		names  []string
+		values []string
+		extra  string
+		want   string
+	}{
+		{nil, nil, "", ""},
+		{nil, nil, `le="0.5"`, `{le="0.5"}`},
+		{[]string{"route"}, []string{"/v2/videos"}, "", `{route="/v2/videos"}`},
+		{[]string{"route", "method"}, []string{"/v2/videos", "GET"}, `le="+Inf"`, `{route="/v2/videos",method="GET",le="+Inf"}`},
+		{[]string{"v"}, []string{`a"b\c` + "\nd"}, "", `{v="a\"b\\c\nd"}`},
+	}
+	for _, tt := range tests {
+		if got := formatLabels(tt.names, tt.values, tt.extra); got != tt.want {
+			t.Errorf("formatLabels(%q, %q, %q) = %s, want %s", tt.names, tt.values, tt.extra, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"go3/env"
+	"log/slog"
+	"math/bits"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// proof of work for anonymous adds: the server hands out a signed challenge bound to a video id,
+// the client looks for a solution so that sha256(challenge + ":" + solution) starts with
+// `difficulty` zero bits. Nothing is stored, the signature and expiry are all the server checks.
+
+const (
+	defaultPowDifficulty = 20
+	maxPowDifficulty     = 32
+	defaultPowTTL        = 5 * time.Minute
+	maxPowSolutionLength = 64
+)
+
+var (
+	errChallengeMissing  = errors.New("missing 'challenge' or 'solution' parameter")
+	errChallengeInvalid  = errors.New("invalid challenge")
+	errChallengeExpired  = errors.New("challenge expired")
+	errChallengeMismatch = errors.New("challenge was issued for another video")
+	errSolutionInvalid   = errors.New("solution does not meet the difficulty")
+)
+
+var (
+	powSecretOnce sync.Once
+	powSecret     []byte
+)
+
+type powPayload struct {
+	Nonce      string `json:"n"`
+	VideoID    string `json:"v"`
+	Difficulty int    `json:"d"`
+	ExpiresAt  int64  `json:"e"`
+}
+
+type ChallengeResponse struct {
+	Challenge  string `json:"challenge"`
+	Difficulty int    `json:"difficulty"`
+	ExpiresAt  int64  `json:"expires_at"`
+	Algorithm  string `json:"algorithm"`
+}
+
+func powEnabled() bool {
+	return env.PowEnabled.Get() == "TRUE"
+}
+
+// only anonymous submissions solve a challenge, an issued API key already identifies the caller
+func needsChallenge(r *http.Request) bool {
+	if !powEnabled() {
+		return false
+	}
+	_, keyed := apiKeyIdentity(r)
+	return !keyed
+}
+
+func powDifficulty() int {
+	return min(max(env.PowDifficulty.Int(defaultPowDifficulty), 1), maxPowDifficulty)
+}
+
+// POW_SECRET keeps challenges valid across restarts and replicas, without it one is generated per process
+func powKey() []byte {
+	powSecretOnce.Do(func() {
+		if secret := env.PowSecret.Get(); secret != "" {
+			powSecret = []byte(secret)
+			return
+		}
+		powSecret = make([]byte, 32)
+		rand.Read(powSecret)
+		slog.Warn("POW_SECRET is not set, using a random key for this process")
+	})
+	return powSecret
+}
+
+func signPayload(payload string) string {
+	mac := hmac.New(sha256.New, powKey())
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func issueChallenge(videoID string) ChallengeResponse {
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	payload := powPayload{
+		Nonce:      hex.EncodeToString(nonce),
+		VideoID:    videoID,
+		Difficulty: powDifficulty(),
+		ExpiresAt:  time.Now().Add(defaultPowTTL).Unix(),
+	}
+	data, _ := json.Marshal(payload)
+	encoded := base64.RawURLEncoding.EncodeToString(data)
+	return ChallengeResponse{
+		Challenge:  encoded + "." + signPayload(encoded),
+		Difficulty: payload.Difficulty,
+		ExpiresAt:  payload.ExpiresAt,
+		Algorithm:  "sha256",
+	}
+}
+
+func leadingZeroBits(sum [32]byte) int {
+	n := 0
+	for _, b := range sum {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
+
+// checks the signature, expiry, video binding and the work itself
+func verifyChallenge(challenge string, solution string, videoID string) error {
+	if challenge == "" || solution == "" || len(solution) > maxPowSolutionLength {
+		return errChallengeMissing
+	}
+	encoded, sig, ok := strings.Cut(challenge, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(signPayload(encoded))) {
+		return errChallengeInvalid
+	}
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return errChallengeInvalid
+	}
+	var payload powPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return errChallengeInvalid
+	}
+	if time.Now().Unix() > payload.ExpiresAt {
+		return errChallengeExpired
+	}
+	if payload.VideoID != videoID {
+		return errChallengeMismatch
+	}
+	// a challenge issued before the difficulty was raised is not good enough anymore
+	difficulty := max(payload.Difficulty, powDifficulty())
+	if leadingZeroBits(sha256.Sum256([]byte(challenge+":"+solution))) < difficulty {
+		return errSolutionInvalid
+	}
+	return nil
+}
+
+func handleChallenge(w http.ResponseWriter, r *http.Request) {
+	if !powEnabled() {
+		http.Error(w, "Challenges are disabled", http.StatusNotFound)
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if !isValidID(id) {
+		http.Error(w, getRandomErrorResponse(), http.StatusBadRequest)
+		logReject(r, "invalid 'id' parameter", "id", id)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(issueChallenge(id))
+}
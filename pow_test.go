@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"go3/db"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestNeedsChallenge(t *testing.T) {
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "videos.db"))
+	t.Setenv("IP_HASH_SECRET", "test")
+	db.InitDB()
+	t.Cleanup(func() { db.DB.Close() })
+	_, key, err := db.IssueAPIKey(context.Background(), "test", db.Audit{Actor: db.ActorSystem})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		enabled string
+		key     string
+		want    bool
+	}{
+		{"disabled", "FALSE", "", false},
+		{"anonymous", "TRUE", "", true},
+		{"made up key", "TRUE", "not-a-key", true},
+		{"issued key", "TRUE", key, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("POW_ENABLED", tt.enabled)
+			r := httptest.NewRequest("POST", "/v2/add?id=vid00000001", nil)
+			if tt.key != "" {
+				r.Header.Set(apiKeyHeader, tt.key)
+			}
+			if got := needsChallenge(r); got != tt.want {
+				t.Errorf("needsChallenge() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter allows a number of events per key in fixed windows,
+// the counts are dropped when a window ends so memory stays bounded by one window of keys
+type rateLimiter struct {
+	mu     sync.Mutex
+	window time.Duration
+	start  time.Time
+	counts map[string]int
+}
+
+func newRateLimiter(window time.Duration) *rateLimiter {
+	return &rateLimiter{window: window, counts: make(map[string]int)}
+}
+
+// counts the event when key is still under limit, limit <= 0 allows everything
+// the duration is how long until the window resets
+func (l *rateLimiter) Allow(key string, limit int) (bool, time.Duration) {
+	if limit <= 0 {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if now.Sub(l.start) >= l.window {
+		l.start = now
+		clear(l.counts)
+	}
+	if l.counts[key] >= limit {
+		return false, l.window - now.Sub(l.start)
+	}
+	l.counts[key]++
+	return true, 0
+}
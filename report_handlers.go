@@ -0,0 +1,173 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"go3/db"
+	"go3/env"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const maxReportNoteLength = 500
+
+type ReportResponse struct {
+	VideoID string `json:"video_id"`
+	Reason  string `json:"reason"`
+}
+
+type ReportListResponse struct {
+	Reports []db.Report `json:"reports"`
+	Offset  int         `json:"offset"`
+}
+
+// distinct open reports after which a video is taken out of rotation, 0 turns auto hiding off
+func reportHideThreshold() int {
+	return env.ReportHideAt.Int(3)
+}
+
+var reportLimiter = newRateLimiter(time.Hour)
+
+// reports one address may file per hour, 0 turns the limit off
+func reportsPerHour() int {
+	return env.ReportRate.Int(10)
+}
+
+func handleReport(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !isValidID(id) {
+		http.Error(w, getRandomErrorResponse(), http.StatusBadRequest)
+		logReject(r, "invalid 'id'", "id", id)
+		return
+	}
+	if ok, retry := reportLimiter.Allow(clientIP(r), reportsPerHour()); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(retry.Seconds())+1))
+		http.Error(w, "Too many reports, try again later", http.StatusTooManyRequests)
+		logReject(r, "report rate limit")
+		return
+	}
+	params := r.URL.Query()
+	reason := params.Get("reason")
+	if !db.IsValidReportReason(reason) {
+		http.Error(w, "'reason' must be one of broken, inappropriate, spam, other", http.StatusBadRequest)
+		return
+	}
+	note := params.Get("note")
+	if len(note) > maxReportNoteLength {
+		http.Error(w, "'note' is too long", http.StatusBadRequest)
+		return
+	}
+
+	exists, err := db.IsVideoSaved(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Failed to check if video exists", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "error checking if video exists", "err", err)
+		return
+	}
+	if !exists {
+		http.Error(w, "Video not found", http.StatusNotFound)
+		return
+	}
+
+	// the peer address or an issued key, headers can't forge more reporters towards the hide threshold
+	audit := requestAudit(r)
+	reporter := audit.Actor
+	hidden, err := db.AddReport(r.Context(), id, reporter, reason, note, reportHideThreshold(), audit)
+	if err == db.ErrDuplicateReport {
+		http.Error(w, "Video already reported", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to save report", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ReportResponse{VideoID: id, Reason: reason})
+	slog.InfoContext(r.Context(), "report", "id", id, "reason", reason, "reporter", reporter)
+	if hidden {
+		slog.InfoContext(r.Context(), "video hidden until an admin reviews its reports", "id", id)
+	}
+}
+
+func handleAdminReports(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = db.ReportsOpen
+	}
+	if status != db.ReportsOpen && status != db.ReportsResolved && status != db.ReportsAll {
+		http.Error(w, "'status' must be one of open, resolved, all", http.StatusBadRequest)
+		return
+	}
+	limit, offset, err := parseLimitOffset(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	reports, err := db.ListReports(r.Context(), status, limit, offset)
+	if err != nil {
+		http.Error(w, "Failed to list reports", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ReportListResponse{Reports: reports, Offset: offset})
+}
+
+func handleAdminResolveReport(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid report id", http.StatusBadRequest)
+		return
+	}
+	var resolution string
+	switch r.URL.Query().Get("action") {
+	case "dismiss":
+		resolution = db.ResolutionDismissed
+	case "hide":
+		resolution = db.ResolutionHidden
+	default:
+		http.Error(w, "'action' must be one of dismiss, hide", http.StatusBadRequest)
+		return
+	}
+
+	report, err := db.ResolveReport(r.Context(), id, resolution, reportHideThreshold(), adminAudit(r))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Report not found", http.StatusNotFound)
+		return
+	}
+	if err == db.ErrReportResolved {
+		http.Error(w, "Report already resolved", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to resolve report", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+	slog.InfoContext(r.Context(), "admin: report resolved", "report", report.ID, "id", report.VideoID, "resolution", resolution)
+}
+
+func handleAdminVideoStatus(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	status := r.URL.Query().Get("status")
+	if !db.IsValidStatus(status) {
+		http.Error(w, "'status' must be one of active, reported, hidden", http.StatusBadRequest)
+		return
+	}
+	err := db.SetVideoStatus(r.Context(), id, status, adminAudit(r))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Video not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update video", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+	slog.InfoContext(r.Context(), "admin: video status set", "id", id, "status", status)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"go3/db"
+	"go3/env"
+	"log/slog"
+	"time"
+)
+
+const ipRetentionCheckInterval = 24 * time.Hour
+
+// forgets submitter IPs older than IP_RETENTION_DAYS, at startup and once a day; 0 keeps them forever
+func runIPRetention(ctx context.Context) {
+	days := env.IPRetention.Int(0)
+	if days <= 0 {
+		return
+	}
+	for {
+		cutoff := time.Now().AddDate(0, 0, -days).Unix()
+		n, err := db.ExpireSubmitterIPs(ctx, cutoff, db.Audit{Actor: db.ActorSystem})
+		if err != nil {
+			slog.Error("error expiring submitter IPs", "err", err)
+		} else if n > 0 {
+			slog.Info("expired submitter IPs", "videos", n, "older_than_days", days)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(ipRetentionCheckInterval):
+		}
+	}
+}
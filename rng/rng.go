@@ -0,0 +1,40 @@
+package rng
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"math/rand"
+)
+
+// Rand is a seedable random source shared by everything that picks a random video.
+// The same seed always produces the same sequence, so a reported pick can be replayed.
+type Rand struct {
+	seed int64
+	r    *rand.Rand
+}
+
+// New returns a Rand seeded with seed
+func New(seed int64) *Rand {
+	return &Rand{seed: seed, r: rand.New(rand.NewSource(seed))}
+}
+
+// NewSeed returns a fresh seed for requests that did not ask for one
+// kept below 2^53 so it survives a round trip through javascript numbers
+// it comes from crypto/rand, seeds taken from the clock repeat under load and can be guessed
+func NewSeed() int64 {
+	var b [8]byte
+	if _, err := crand.Read(b[:]); err != nil {
+		panic("rng: reading random bytes: " + err.Error())
+	}
+	return int64(binary.BigEndian.Uint64(b[:]) & (1<<53 - 1))
+}
+
+// Seed returns the seed this Rand was created with
+func (r *Rand) Seed() int64 {
+	return r.seed
+}
+
+// Intn returns a number in [0, n)
+func (r *Rand) Intn(n int) int {
+	return r.r.Intn(n)
+}
@@ -1 +1 @@
-go run server.go video_manager.go
\ No newline at end of file
+go run -tags sqlite_fts5 .
\ No newline at end of file
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"go3/db"
+	"html"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+const maxSearchQueryLength = 200
+
+type SearchResultResponse struct {
+	VideoDetailResponse
+	TitleSnippet  string  `json:"title_snippet"`
+	AuthorSnippet string  `json:"author_snippet"`
+	Score         float64 `json:"score"`
+}
+
+type SearchResponse struct {
+	Query   string                 `json:"query"`
+	Results []SearchResultResponse `json:"results"`
+	Offset  int                    `json:"offset"`
+}
+
+// escapes the snippet for html and turns the db markers into <mark> tags
+func renderSnippet(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	snippet = strings.ReplaceAll(snippet, db.SnippetOpen, "<mark>")
+	return strings.ReplaceAll(snippet, db.SnippetClose, "</mark>")
+}
+
+func handleSearch(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	query := strings.TrimSpace(params.Get("q"))
+	if query == "" || len(query) > maxSearchQueryLength {
+		http.Error(w, getRandomErrorResponse(), http.StatusBadRequest)
+		logReject(r, "invalid 'q' parameter", "query", r.URL.RawQuery)
+		return
+	}
+
+	limit, offset, err := parseLimitOffset(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	results, err := db.SearchVideos(r.Context(), query, limit, offset)
+	if err == db.ErrSearchDisabled {
+		http.Error(w, "Search is not available", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to search videos", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "error searching videos", "err", err)
+		return
+	}
+
+	response := SearchResponse{
+		Query:   query,
+		Results: make([]SearchResultResponse, 0, len(results)),
+		Offset:  offset,
+	}
+	for _, result := range results {
+		response.Results = append(response.Results, SearchResultResponse{
+			VideoDetailResponse: newVideoDetailResponse(result.Video, ""),
+			TitleSnippet:        renderSnippet(result.TitleSnippet),
+			AuthorSnippet:       renderSnippet(result.AuthorSnippet),
+			// bm25 is negative, lower is better; flip it so clients can sort descending
+			Score: -result.Rank,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+	slog.InfoContext(r.Context(), "search", "q", query, "results", len(results))
+}
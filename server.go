@@ -1,15 +1,19 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"go3/db"
 	"go3/env"
-	"log"
+	"go3/logging"
+	"go3/rng"
+	"log/slog"
 	"math/rand"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -20,9 +24,25 @@ import (
 )
 
 type config struct {
-	Migrate bool `clap:"--migrate,-m"`
-	ClearDB bool `clap:"--YES-I-REALLY-WANT-TO-DELETE-ALL-DATA"`
-	Update  bool `clap:"--update,-u"`
+	Migrate   bool   `clap:"--migrate,-m"`
+	ClearDB   bool   `clap:"--YES-I-REALLY-WANT-TO-DELETE-ALL-DATA"`
+	Update    bool   `clap:"--update,-u"`
+	Reindex   bool   `clap:"--reindex"`
+	Block     bool   `clap:"--apply-blocklist"`
+	Undelete  string `clap:"--undelete"`
+	PurgeDays int    `clap:"--purge-deleted"`
+	Backup    string `clap:"--backup"`
+	Restore   string `clap:"--restore"`
+	Export    string `clap:"--export"`
+	Import    string `clap:"--import"`
+	Format    string `clap:"--format"`
+	Conflict  string `clap:"--on-conflict"`
+	DryRun    bool   `clap:"--dry-run"`
+	Fields    string `clap:"--fields"`
+	// used by the subcommands
+	Output string   `clap:"--output,-o"`
+	Days   int      `clap:"--days"`
+	Args   []string `clap:"trailing"`
 }
 
 var (
@@ -31,11 +51,13 @@ var (
 )
 
 type VideoResponse struct {
-	ID              string `json:"id"`
-	VideoName       string `json:"video_name"`
-	VideoAuthorName string `json:"video_author_name"`
-	IsEmbeddable    bool   `json:"is_embeddable"`
-	LogoURL         string `json:"logo_url"`
+	ID              string       `json:"id"`
+	VideoName       string       `json:"video_name"`
+	VideoAuthorName string       `json:"video_author_name"`
+	IsEmbeddable    bool         `json:"is_embeddable"`
+	LogoURL         string       `json:"logo_url"`
+	Seed            int64        `json:"seed"`
+	Votes           db.VoteScore `json:"votes"`
 }
 
 type YouTubeResponse struct {
@@ -84,9 +106,9 @@ func loadVideos() []string {
 	filename := env.VideosIDFile.Get()
 	videos, err := LoadVideos(filename)
 	if err != nil {
-		log.Fatal("Error loading videos: \n" + err.Error())
+		fatal("error loading videos", "err", err)
 	}
-	log.Printf("Loaded [%d] videos\n", len(videos))
+	slog.Info("loaded videos", "count", len(videos))
 	return videos
 }
 
@@ -111,8 +133,17 @@ func loadVideos() []string {
 // 	return videos, nil
 // }
 
-func getRandomVideo(videos []string) string {
-	return videos[rand.Intn(len(videos))]
+func getRandomVideo(r *rng.Rand, videos []string) string {
+	return videos[r.Intn(len(videos))]
+}
+
+// reads the optional 'seed' parameter, a fresh seed is generated when it is missing
+func parseSeed(r *http.Request) (int64, error) {
+	raw := r.URL.Query().Get("seed")
+	if raw == "" {
+		return rng.NewSeed(), nil
+	}
+	return strconv.ParseInt(raw, 10, 64)
 }
 
 // func isValidVideoID(id string) bool {
@@ -133,21 +164,24 @@ func getRandomVideo(videos []string) string {
 // }
 
 func handleRandomV2(w http.ResponseWriter, r *http.Request) {
+	seed, err := parseSeed(r)
+	if err != nil {
+		http.Error(w, getRandomErrorResponse(), http.StatusBadRequest)
+		logReject(r, "invalid 'seed' parameter", "seed", r.URL.Query().Get("seed"))
+		return
+	}
+
 	mu.Lock()
 	defer mu.Unlock()
 
-	video, err := db.GetRandomVideo()
+	video, err := db.GetRandomVideo(r.Context(), rng.New(seed))
 	if err != nil {
 		http.Error(w, "Failed to get random video", http.StatusInternalServerError)
-		log.Println("Error getting random video: ", err)
+		slog.ErrorContext(r.Context(), "error getting random video", "err", err)
 		return
 	}
 
-	logo, err := fetchYTLogoLink(video.ChannelID)
-	if err != nil {
-		log.Println("Error fetching logo: ", err)
-		logo = ""
-	}
+	logo := channelLogo(r.Context(), video.ChannelID)
 
 	//return json response in VideoResponse format
 	w.Header().Set("Content-Type", "application/json")
@@ -157,9 +191,12 @@ func handleRandomV2(w http.ResponseWriter, r *http.Request) {
 		VideoAuthorName: video.VideoAuthorName,
 		IsEmbeddable:    video.IsEmbeddable,
 		LogoURL:         logo,
+		Seed:            seed,
+		Votes:           videoVotes(r.Context(), video.ID),
 	}
 	json.NewEncoder(w).Encode(response)
-	log.Println("Requested random video: " + video.ID)
+	stats.RecordImpression(video.ID)
+	slog.InfoContext(r.Context(), "requested random video", "id", video.ID, "seed", seed)
 }
 
 func handleRandom(w http.ResponseWriter, r *http.Request) {
@@ -172,34 +209,22 @@ func handleRandom(w http.ResponseWriter, r *http.Request) {
 	// 	return
 	// }
 
-	randomVideo := getRandomVideo(videos)
+	randomVideo := getRandomVideo(rng.New(rng.NewSeed()), videos)
 	fmt.Fprintln(w, randomVideo)
-	log.Println("Requested random video: " + randomVideo)
+	slog.InfoContext(r.Context(), "requested random video", "id", randomVideo)
 }
 
-func fetchYTVideoInfo(id string) (YouTubeResponse, error) {
+func fetchYTVideoInfo(ctx context.Context, id string) (YouTubeResponse, error) {
 	apiKey := env.YTDataAPIv3Key.Get()
 	url := fmt.Sprintf("https://www.googleapis.com/youtube/v3/videos?id=%s&key=%s&part=snippet,status,contentDetails", id, apiKey)
-	resp, err := http.Get(url)
-	if err != nil {
-		log.Println("[yt] Error fetching video info: ", err)
-		return YouTubeResponse{}, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		log.Println("[yt] Error fetching video info: ", resp.Status)
-		return YouTubeResponse{}, err
-	}
-
 	var ytResp YouTubeResponse
-	if err := json.NewDecoder(resp.Body).Decode(&ytResp); err != nil {
-		log.Println("[yt] Error parsing YouTube response: ", err)
+	if err := ytGet(ctx, "videos", url, &ytResp); err != nil {
+		slog.ErrorContext(ctx, "error fetching video info", "component", "youtube", "err", err)
 		return YouTubeResponse{}, err
 	}
 
 	if len(ytResp.Items) == 0 {
-		// log.Println("[yt] Video not found: ", id)
+		// slog.InfoContext(ctx, "video not found", "component", "youtube", "id", id)
 		return YouTubeResponse{}, errors.New("video not found")
 	}
 	return ytResp, nil
@@ -221,83 +246,96 @@ func assembleVideo(ytResp YouTubeResponse, ip string, id string) db.Video {
 	}
 }
 
-// generates a random request ID
-// curr unix time + random number
-// 01724:910412
-func genRequestID() string {
-	return fmt.Sprintf("%d:%d", time.Now().Unix(), rand.Intn(9000)+1000)
-}
-
 func handleAdd(w http.ResponseWriter, r *http.Request) {
-	requestID := genRequestID()
-	ip := r.RemoteAddr
-	if prior := r.Header.Get("X-Forwarded-For"); prior != "" {
-		ip = prior
-	}
-	log.Printf("[%s] [NEW] [/v2/add] [%s] request ADD VIDEO", requestID, ip)
+	ip := clientIP(r)
+	slog.InfoContext(r.Context(), "request ADD VIDEO", "ip", ip)
 
 	if r.Method != http.MethodPost {
 		http.Error(w, getRandomErrorResponse(), http.StatusBadRequest)
-		log.Printf("[%s] [REJECT] method not allowed: '%s'", requestID, r.Method)
-		log.Printf("[%s] TRY: '%s'\n", requestID, r.URL.RawQuery)
+		logReject(r, "method not allowed", "method", r.Method, "query", r.URL.RawQuery)
 		return
 	}
 
 	id := r.URL.Query().Get("id")
 	if id == "" {
 		http.Error(w, getRandomErrorResponse(), http.StatusBadRequest)
-		log.Printf("[%s] [REJECT] missing 'id' parameter", requestID)
-		log.Printf("[%s] TRY: '%s'\n", requestID, r.URL.RawQuery)
+		logReject(r, "missing 'id' parameter", "query", r.URL.RawQuery)
 		return
 	}
 
 	if !isValidID(id) {
 		http.Error(w, getRandomErrorResponse(), http.StatusBadRequest)
-		log.Printf("[%s] [REJECT] invalid 'id' parameter", requestID)
-		log.Printf("[%s] TRY: '%s'\n", requestID, r.URL.RawQuery)
+		logReject(r, "invalid 'id' parameter", "query", r.URL.RawQuery)
 		return
 	}
 
-	log.Printf("[%s] [CONTINUE] Request is valid, adding video: %s", requestID, id)
+	if needsChallenge(r) {
+		params := r.URL.Query()
+		if err := verifyChallenge(params.Get("challenge"), params.Get("solution"), id); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			logReject(r, "proof of work failed", "err", err)
+			return
+		}
+	}
+
+	slog.InfoContext(r.Context(), "request is valid, adding video", "id", id)
 
 	//check if video exists
-	exists, err := db.IsVideoSaved(id)
+	exists, err := db.IsVideoSaved(r.Context(), id)
 	if err != nil {
 		http.Error(w, "Failed to check if video exists", http.StatusInternalServerError)
-		log.Printf("[%s] [WARN] [DB] Error checking if video exists: %s", requestID, err)
+		slog.ErrorContext(r.Context(), "error checking if video exists", "err", err)
 		return
 	}
 	if exists {
 		http.Error(w, "Video already exists", http.StatusConflict)
-		log.Printf("[%s] [REJECT] [DB] Video already exists: %s", requestID, id)
+		logReject(r, "video already exists", "id", id)
+		return
+	}
+	// a deleted video keeps its row until purged, only an admin can bring it back
+	deleted, err := db.IsVideoDeleted(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Failed to check if video exists", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "error checking if video is deleted", "err", err)
+		return
+	}
+	if deleted {
+		http.Error(w, "Video was deleted", http.StatusGone)
+		logReject(r, "video was deleted", "id", id)
 		return
 	}
-	log.Printf("[%s] [DB] ID is not in database: %s", requestID, id)
+	slog.DebugContext(r.Context(), "id is not in database", "id", id)
 
-	ytResp, err := fetchYTVideoInfo(id)
+	ytResp, err := fetchYTVideoInfo(r.Context(), id)
 	if err != nil {
-		log.Printf("[%s] [REJECT] [YT] Error fetching video info: %s", requestID, err)
+		logReject(r, "error fetching video info", "id", id, "err", err)
 		http.Error(w, "", http.StatusNotFound)
 		return
 	}
-	log.Printf("[%s] [CONTINUE] [YT] Video info fetched: %s", requestID, id)
+	slog.DebugContext(r.Context(), "video info fetched", "id", id)
 
 	video := assembleVideo(ytResp, ip, id)
+	video.Submitter = clientIdentity(r)
+
+	if entry, ok := blocklist.Match(r.Context(), video); ok {
+		http.Error(w, "Video is not allowed", http.StatusForbidden)
+		logReject(r, "video matches blocklist", "id", id, "entry", entry.ID, "kind", entry.Kind, "pattern", entry.Pattern)
+		return
+	}
 
-	log.Printf("[%s] Parsed video:\n- ID: %s\n- Name: %s\n- Author: %s\n- Embeddable: %t\n- Timestamp: %d\n- IP: %s\n- Channel ID: %s\n",
-		requestID,
-		video.ID,
-		video.VideoName,
-		video.VideoAuthorName,
-		video.IsEmbeddable,
-		video.AddedAt,
-		video.AddedFromIP,
-		video.ChannelID,
+	slog.InfoContext(r.Context(), "parsed video",
+		"id", video.ID,
+		"name", video.VideoName,
+		"author", video.VideoAuthorName,
+		"embeddable", video.IsEmbeddable,
+		"timestamp", video.AddedAt,
+		"ip", video.AddedFromIP,
+		"channel_id", video.ChannelID,
 	)
 
 	// Insert into Database
-	if err := db.InsertVideo(video); err != nil {
-		log.Printf("[%s] [FATAL] [DB] Failed to insert video into database: %s", requestID, err)
+	if err := db.InsertVideo(r.Context(), video, requestAudit(r)); err != nil {
+		slog.ErrorContext(r.Context(), "failed to insert video into database", "err", err)
 		// We continue even if DB insert fails? Or return error?
 		// For now, let's just log it and continue with the JSON file update
 		http.Error(w, "servaku pizda", http.StatusInternalServerError)
@@ -315,68 +353,63 @@ func handleAdd(w http.ResponseWriter, r *http.Request) {
 		VideoAuthorName: video.VideoAuthorName,
 		IsEmbeddable:    video.IsEmbeddable,
 		LogoURL:         "",
+		Seed:            rng.NewSeed(),
 	}
 	json.NewEncoder(w).Encode(response)
 	//fmt.Fprintf(w, "Successfully added video '%s' (%s)\n", video.ID, video.VideoName)
 }
 
-func migrateDBfromJSON() {
+func migrateDBfromJSON(ctx context.Context, audit db.Audit) {
 	videos := loadVideos()
 	for _, video := range videos {
-		log.Println(video, "- migrating video...")
-		exists, err := db.IsVideoSaved(video)
+		slog.InfoContext(ctx, "migrating video", "id", video)
+		exists, err := db.IsVideoSaved(ctx, video)
 		if err != nil {
-			log.Println("Error checking if video exists: ", err)
+			slog.ErrorContext(ctx, "error checking if video exists", "err", err)
 			return
 		}
 		if exists {
-			log.Println(video, "- video already exists")
+			slog.InfoContext(ctx, "video already exists", "id", video)
 			continue
 		}
-		ytResp, err := fetchYTVideoInfo(video)
+		ytResp, err := fetchYTVideoInfo(ctx, video)
 		if err != nil {
-			log.Println("Error fetching video info: ", err)
+			slog.ErrorContext(ctx, "error fetching video info", "err", err)
 			return
 		}
-		err = db.InsertVideo(db.Video{
+		err = db.InsertVideo(ctx, db.Video{
 			ID:              video,
 			VideoName:       ytResp.Items[0].Snippet.Title,
 			VideoAuthorName: ytResp.Items[0].Snippet.ChannelTitle,
 			IsEmbeddable:    ytResp.Items[0].Status.Embeddable,
 			AddedAt:         time.Now().Unix(),
-			AddedFromIP:     "migrated",
-		})
+			AddedFromIP:     db.IPMigrated,
+		}, audit)
 		if err != nil {
-			log.Println("Error inserting video: ", err)
+			slog.ErrorContext(ctx, "error inserting video", "err", err)
 		}
-		log.Println(video, "- migrated")
+		slog.InfoContext(ctx, "migrated", "id", video)
 	}
 }
 
-func parseArgs() config {
-	args := os.Args[1:]
-	cfg := config{Migrate: false}
+func parseArgs(args []string) config {
+	// --purge-deleted 0 is a valid request, so unset is -1
+	cfg := config{Migrate: false, PurgeDays: -1, Conflict: db.ImportSkip, Output: outputTable, Days: 7}
 
 	_, err := clap.Parse(args, &cfg)
 	if err != nil {
-		log.Fatal(err)
+		fatal("error parsing arguments", "err", err)
 	}
 
 	return cfg
 }
 
-func fetchYTLogoLink(channelId string) (string, error) {
+func fetchYTLogoLink(ctx context.Context, channelId string) (string, error) {
 	apiKey := env.YTDataAPIv3Key.Get()
 	url := fmt.Sprintf("https://www.googleapis.com/youtube/v3/channels?part=snippet&id=%s&key=%s", channelId, apiKey)
 
-	resp, err := http.Get(url)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
 	var ytResp YTChannelResponse
-	if err := json.NewDecoder(resp.Body).Decode(&ytResp); err != nil {
+	if err := ytGet(ctx, "channels", url, &ytResp); err != nil {
 		return "", err
 	}
 
@@ -425,89 +458,194 @@ func getRandomErrorResponse() string {
 }
 
 func main() {
-	args := parseArgs()
+	command, rest := splitCommand(os.Args[1:])
+	if !isValidCommand(command) || command == commandHelp {
+		fmt.Fprint(os.Stderr, usage)
+		if command != commandHelp {
+			os.Exit(2)
+		}
+		return
+	}
+	args := parseArgs(rest)
+	if command != commandServe {
+		// stdout carries the command output, so no banner
+		env.LoadEnv()
+		setupLogging()
+		db.InitDB()
+		os.Exit(runCommand(command, args))
+	}
+
 	Env()
+	setupLogging()
+	// restoring overwrites the database file, so it runs before anything opens it
+	if args.Restore != "" {
+		if err := db.Restore(args.Restore, env.DBPath.Get()); err != nil {
+			fatal("error restoring database", "err", err)
+		}
+		return
+	}
 	db.InitDB()
+	if args.Backup != "" {
+		if err := db.Backup(args.Backup); err != nil {
+			fatal("error backing up database", "err", err)
+		}
+		return
+	}
 
-	log.Println("Migrate:", args.Migrate)
-	log.Println("ClearDB:", args.ClearDB)
-	log.Println("Update:", args.Update)
+	slog.Info("maintenance flags", "migrate", args.Migrate, "clear_db", args.ClearDB, "update", args.Update, "reindex", args.Reindex, "apply_blocklist", args.Block)
+	audit := cliAudit()
+	ctx := logging.WithRequestID(context.Background(), audit.RequestID)
 	if args.Migrate {
-		migrateDBfromJSON()
+		migrateDBfromJSON(ctx, audit)
 	}
 	if args.ClearDB {
-		db.ClearDB()
+		if err := db.ClearDB(ctx, audit); err != nil {
+			slog.ErrorContext(ctx, "error clearing database", "err", err)
+		}
 	}
 	if args.Update {
-		videos, err := db.GetAllVideos()
+		opts, err := parseUpdateOptions(args)
 		if err != nil {
-			log.Println("Error getting videos:", err)
-			return
+			fatal(err.Error())
 		}
-		for _, video := range videos {
-			log.Println(video, "- updating video credentials...")
-			ytResp, err := fetchYTVideoInfo(video.ID)
-			if err != nil {
-				log.Println("Error fetching video info: ", err)
-				continue
-			}
-			updatedVideo := assembleVideo(ytResp, video.AddedFromIP, video.ID)
-			err = db.UpdateVideo(updatedVideo)
-			if err != nil {
-				log.Println("Error updating video: ", err)
-			}
-			log.Println(video, "- updated")
+		printDiffs(updateVideos(ctx, nil, opts, audit), outputTable)
+	}
+	if args.Reindex {
+		if err := db.RebuildSearchIndex(); err != nil {
+			slog.ErrorContext(ctx, "error rebuilding search index", "err", err)
 		}
 	}
-	count, err := db.CountSavedVideos()
+	if args.Block {
+		applyBlocklist(ctx, audit)
+	}
+	if args.Undelete != "" {
+		undeleteVideos(ctx, args.Undelete, audit)
+	}
+	if args.PurgeDays >= 0 {
+		purgeDeletedVideos(ctx, args.PurgeDays, audit)
+	}
+	if args.Import != "" {
+		importFromFile(ctx, args.Import, args.Format, args.Conflict, audit)
+	}
+	if args.Export != "" {
+		exportToFile(ctx, args.Export, args.Format)
+	}
+	count, err := db.CountSavedVideos(ctx)
 	if err != nil {
-		log.Println("Error getting number of videos:", err)
+		slog.ErrorContext(ctx, "error getting number of videos", "err", err)
 		return
 	}
-	log.Println("Number of videos:", count)
+	slog.InfoContext(ctx, "number of videos", "count", count)
+
+	if err := bans.Reload(ctx); err != nil {
+		slog.ErrorContext(ctx, "error loading bans", "err", err)
+	}
+	if err := blocklist.Reload(ctx); err != nil {
+		slog.ErrorContext(ctx, "error loading blocklist", "err", err)
+	}
+	startBackground(func(ctx context.Context) {
+		stats.Run(ctx, statsFlushInterval())
+	})
+	startBackground(runIPRetention)
+	startBackground(runBackups)
+	startBackground(logoFetches.run)
 
 	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", handleHealthz)
+	mux.HandleFunc("GET /readyz", handleReadyz)
+	mux.HandleFunc("GET /version", handleVersion)
+	mux.HandleFunc("GET /metrics", handleMetrics)
 	mux.HandleFunc("/get_random", handleRandom)
 	mux.HandleFunc("/v2/get_random", handleRandomV2)
-	mux.HandleFunc("/v2/add", handleAdd)
+	mux.HandleFunc("/v2/add", rejectBanned(handleAdd))
+	mux.HandleFunc("GET /v2/challenge", handleChallenge)
+	mux.HandleFunc("GET /v2/videos", handleVideoList)
+	mux.HandleFunc("GET /v2/videos/{id}", handleVideoGet)
+	mux.HandleFunc("HEAD /v2/videos/{id}", handleVideoHead)
+	mux.HandleFunc("GET /v2/search", handleSearch)
+	mux.HandleFunc("POST /v2/videos/{id}/vote", rejectBanned(handleVote))
+	mux.HandleFunc("POST /v2/videos/{id}/report", rejectBanned(handleReport))
+	mux.HandleFunc("POST /v2/videos/{id}/played", handlePlayed)
+	mux.HandleFunc("GET /v2/videos/{id}/stats", handleVideoStats)
+	mux.HandleFunc("GET /v2/videos/{id}/history", handleVideoHistory)
+	mux.HandleFunc("GET /v2/stats", handleStats)
+	mux.HandleFunc("GET /v2/top", handleTop)
+	mux.HandleFunc("GET /v2/submitters", handleSubmitterList)
+	mux.HandleFunc("GET /v2/submitters/{id}/videos", handleSubmitterVideos)
+	mux.HandleFunc("GET /v2/channels", handleChannelList)
+	mux.HandleFunc("GET /v2/channels/{id}/videos", handleChannelVideos)
+	mux.HandleFunc("GET /v2/channels/{id}/random", handleChannelRandom)
+	mux.HandleFunc("GET /v2/admin/reports", requireAdmin(handleAdminReports))
+	mux.HandleFunc("POST /v2/admin/reports/{id}/resolve", requireAdmin(handleAdminResolveReport))
+	mux.HandleFunc("POST /v2/admin/videos/{id}/status", requireAdmin(handleAdminVideoStatus))
+	mux.HandleFunc("GET /v2/admin/videos/deleted", requireAdmin(handleAdminDeletedVideos))
+	mux.HandleFunc("DELETE /v2/admin/videos/{id}", requireAdmin(handleAdminDeleteVideo))
+	mux.HandleFunc("POST /v2/admin/videos/{id}/restore", requireAdmin(handleAdminRestoreVideo))
+	mux.HandleFunc("GET /v2/admin/bans", requireAdmin(handleAdminBans))
+	mux.HandleFunc("POST /v2/admin/bans", requireAdmin(handleAdminAddBan))
+	mux.HandleFunc("DELETE /v2/admin/bans/{id}", requireAdmin(handleAdminDeleteBan))
+	mux.HandleFunc("GET /v2/admin/keys", requireAdmin(handleAdminAPIKeys))
+	mux.HandleFunc("POST /v2/admin/keys", requireAdmin(handleAdminIssueAPIKey))
+	mux.HandleFunc("DELETE /v2/admin/keys/{id}", requireAdmin(handleAdminRevokeAPIKey))
+	mux.HandleFunc("GET /v2/admin/blocklist", requireAdmin(handleAdminBlocklist))
+	mux.HandleFunc("POST /v2/admin/blocklist", requireAdmin(handleAdminAddBlockEntry))
+	mux.HandleFunc("DELETE /v2/admin/blocklist/{id}", requireAdmin(handleAdminDeleteBlockEntry))
+	mux.HandleFunc("GET /v2/admin/audit", requireAdmin(handleAdminAudit))
+	mux.HandleFunc("POST /v2/admin/backup", requireAdmin(handleAdminBackup))
+	mux.HandleFunc("GET /v2/admin/export", requireAdmin(handleAdminExport))
+	mux.HandleFunc("POST /v2/admin/import", requireAdmin(handleAdminImport))
+
+	accessLog, err = newAccessLogger()
+	if err != nil {
+		fatal("error setting up the access log", "err", err)
+	}
 
 	address := fmt.Sprintf("%s:%s", env.Host.Get(), env.Port.Get())
 
 	if env.UseTLS.Get() == "FALSE" {
 		err := serve(address, mux)
 		if err != nil {
-			log.Fatal("Server failed: ", err)
+			fatal("server failed", "err", err)
 		}
 		return
 	}
 	if env.UseTLS.Get() == "TRUE" {
 		err := serveTLS(address, mux)
 		if err != nil {
-			log.Fatal("Server failed: ", err)
+			fatal("server failed", "err", err)
 		}
 		return
 	}
 }
 
+// the request id goes first so everything after it logs with the id,
+// the rest must hand the request down unchanged to see the r.Pattern the mux sets on it
+func withMiddleware(mux *http.ServeMux) http.Handler {
+	return withRequestID(instrument(accessLog.Wrap(mux)))
+}
+
 func serve(addr string, mux *http.ServeMux) error {
-	log.Printf("Server starting on http://%s\n\n", addr)
-	return http.ListenAndServe(addr, mux)
+	slog.Info("server starting", "url", "http://"+addr)
+	return runServer(newServer(addr, withMiddleware(mux)), func(srv *http.Server) error {
+		return srv.ListenAndServe()
+	})
 }
 
 func serveTLS(addr string, mux *http.ServeMux) error {
 	allowedOrigins := strings.Split(env.AllowedOrigins.Get(), ",")
 	allowedMethods := strings.Split(env.AllowedMethods.Get(), ",")
-	log.Println("AllowedOrigins: ", allowedOrigins)
-	log.Println("AllowedMethods: ", allowedMethods)
+	slog.Info("cors", "allowed_origins", allowedOrigins, "allowed_methods", allowedMethods)
 	handler := cors.New(cors.Options{
 		AllowedOrigins:   allowedOrigins,
 		AllowedMethods:   allowedMethods,
 		AllowedHeaders:   []string{"*"},
+		ExposedHeaders:   []string{requestIDHeader},
 		AllowCredentials: true,
-	}).Handler(mux)
+	}).Handler(withMiddleware(mux))
 
-	log.Println("TLS cert path: ", env.TLSCertPath.Get())
-	log.Println("TLS key path: ", env.TLSKeyPath.Get())
-	log.Printf("Server starting on https://%s\n\n", addr)
-	return http.ListenAndServeTLS(addr, env.TLSCertPath.Get(), env.TLSKeyPath.Get(), handler)
+	slog.Info("tls", "cert_path", env.TLSCertPath.Get(), "key_path", env.TLSKeyPath.Get())
+	slog.Info("server starting", "url", "https://"+addr)
+	return runServer(newServer(addr, handler), func(srv *http.Server) error {
+		return srv.ListenAndServeTLS(env.TLSCertPath.Get(), env.TLSKeyPath.Get())
+	})
 }
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"go3/db"
+	"go3/env"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// limits for ordinary requests, import and export move their own deadlines with extendDeadlines
+const (
+	readHeaderTimeout = 10 * time.Second
+	readTimeout       = 30 * time.Second
+	writeTimeout      = 2 * time.Minute
+	idleTimeout       = 2 * time.Minute
+	// import and export read or write the whole catalog
+	transferTimeout = 30 * time.Minute
+)
+
+func newServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+	}
+}
+
+// gives a request transferTimeout to read its body and write its response instead of the server wide timeouts
+func extendDeadlines(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	deadline := time.Now().Add(transferTimeout)
+	if err := rc.SetReadDeadline(deadline); err != nil {
+		slog.WarnContext(r.Context(), "error extending read deadline", "err", err)
+	}
+	if err := rc.SetWriteDeadline(deadline); err != nil {
+		slog.WarnContext(r.Context(), "error extending write deadline", "err", err)
+	}
+}
+
+// background jobs run with backgroundCtx, closeBackground cancels it and waits for them before closing the db
+var (
+	backgroundCtx, stopBackground = context.WithCancel(context.Background())
+	backgroundJobs                sync.WaitGroup
+)
+
+func startBackground(job func(ctx context.Context)) {
+	backgroundJobs.Add(1)
+	go func() {
+		defer backgroundJobs.Done()
+		job(backgroundCtx)
+	}()
+}
+
+// how long in-flight requests get to finish after SIGINT/SIGTERM
+func shutdownTimeout() time.Duration {
+	return time.Duration(env.ShutdownSecs.Int(20)) * time.Second
+}
+
+// serves until SIGINT/SIGTERM, then stops accepting connections, drains requests and closes the db
+// a second signal while draining kills the process right away
+func runServer(srv *http.Server, listen func(*http.Server) error) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	failed := make(chan error, 1)
+	go func() {
+		if err := listen(srv); !errors.Is(err, http.ErrServerClosed) {
+			failed <- err
+		}
+	}()
+
+	select {
+	case err := <-failed:
+		return err
+	case <-ctx.Done():
+	}
+	stop()
+
+	slog.Info("shutting down, draining requests", "timeout", shutdownTimeout().String())
+	drainCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+	defer cancel()
+	drained := true
+	if err := srv.Shutdown(drainCtx); err != nil {
+		slog.Error("error draining requests", "err", err)
+		// handlers still running keep using the db, their connections are cut so they fail fast
+		srv.Close()
+		drained = false
+	}
+	closeBackground(drained)
+	slog.Info("server stopped")
+	return nil
+}
+
+// stops the background jobs and finishes work that still needs the db,
+// the db is only closed when no handler can use it anymore
+func closeBackground(drained bool) {
+	stopBackground()
+	backgroundJobs.Wait()
+	stats.Flush()
+	if err := accessLog.Close(); err != nil {
+		slog.Error("error closing access log", "err", err)
+	}
+	if !drained {
+		slog.Warn("requests still running, leaving the database open", "component", "db")
+		return
+	}
+	// wait for a backup in progress, nothing starts a new one after this
+	backupMu.Lock()
+	if err := db.DB.Close(); err != nil {
+		slog.Error("error closing database", "component", "db", "err", err)
+		return
+	}
+	slog.Info("database closed", "component", "db")
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"go3/db"
+	"go3/env"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// pending counters are flushed early once this many video/day pairs are buffered
+const maxBufferedStats = 1000
+
+const maxStatsDays = 365
+
+// statsBuffer counts impressions and plays in memory and writes them to the db in batches,
+// a write per served video would cost more than serving it
+type statsBuffer struct {
+	mu      sync.Mutex
+	pending map[db.StatKey]db.StatCounts
+	full    chan struct{}
+	// one flush at a time, so the last flush on shutdown waits for one already running
+	flushing sync.Mutex
+}
+
+var stats = newStatsBuffer()
+
+func newStatsBuffer() *statsBuffer {
+	return &statsBuffer{
+		pending: make(map[db.StatKey]db.StatCounts),
+		full:    make(chan struct{}, 1),
+	}
+}
+
+func statsDay(t time.Time) string {
+	return t.UTC().Format(db.StatsDayLayout)
+}
+
+func (s *statsBuffer) add(videoID string, impressions int64, plays int64) {
+	key := db.StatKey{VideoID: videoID, Day: statsDay(time.Now())}
+	s.mu.Lock()
+	counts := s.pending[key]
+	counts.Impressions += impressions
+	counts.Plays += plays
+	s.pending[key] = counts
+	size := len(s.pending)
+	s.mu.Unlock()
+
+	if size >= maxBufferedStats {
+		select {
+		case s.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (s *statsBuffer) RecordImpression(videoID string) {
+	s.add(videoID, 1, 0)
+}
+
+func (s *statsBuffer) RecordPlay(videoID string) {
+	s.add(videoID, 0, 1)
+}
+
+// writes everything buffered so far, counters go back into the buffer when the write fails
+func (s *statsBuffer) Flush() {
+	s.flushing.Lock()
+	defer s.flushing.Unlock()
+
+	s.mu.Lock()
+	batch := s.pending
+	s.pending = make(map[db.StatKey]db.StatCounts)
+	s.mu.Unlock()
+
+	if len(batch) == 0 {
+		return
+	}
+	if err := db.AddStats(batch); err != nil {
+		slog.Error("error flushing stats, keeping them for the next flush", "err", err)
+		s.mu.Lock()
+		for key, counts := range batch {
+			merged := s.pending[key]
+			merged.Impressions += counts.Impressions
+			merged.Plays += counts.Plays
+			s.pending[key] = merged
+		}
+		s.mu.Unlock()
+		return
+	}
+	slog.Info("flushed stats", "videos", len(batch))
+}
+
+// flushes every interval or as soon as the buffer fills up
+func (s *statsBuffer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.full:
+		}
+		s.Flush()
+	}
+}
+
+// STATS_FLUSH_SECONDS, values below 1 fall back to the default since the ticker needs a positive interval
+func statsFlushInterval() time.Duration {
+	secs := env.StatsFlushSecs.Int(30)
+	if secs <= 0 {
+		secs = 30
+	}
+	return time.Duration(secs) * time.Second
+}
+
+type StatsResponse struct {
+	Days []db.DayStats   `json:"days"`
+	Top  []db.VideoStats `json:"top"`
+}
+
+type VideoStatsResponse struct {
+	ID    string        `json:"id"`
+	Days  []db.DayStats `json:"days"`
+	Total db.StatCounts `json:"total"`
+}
+
+// reads the 'days' parameter and returns the first day to include
+func parseStatsSince(r *http.Request) (string, bool) {
+	days := 7
+	if raw := r.URL.Query().Get("days"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxStatsDays {
+			return "", false
+		}
+		days = n
+	}
+	return statsDay(time.Now().AddDate(0, 0, 1-days)), true
+}
+
+func handlePlayed(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !isValidID(id) {
+		http.Error(w, getRandomErrorResponse(), http.StatusBadRequest)
+		return
+	}
+	exists, err := db.IsVideoSaved(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Failed to check if video exists", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Video not found", http.StatusNotFound)
+		return
+	}
+	stats.RecordPlay(id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleStats(w http.ResponseWriter, r *http.Request) {
+	since, ok := parseStatsSince(r)
+	if !ok {
+		http.Error(w, "invalid 'days' parameter", http.StatusBadRequest)
+		return
+	}
+	days, err := db.GetDailyStats(r.Context(), since)
+	if err != nil {
+		http.Error(w, "Failed to get stats", http.StatusInternalServerError)
+		return
+	}
+	top, err := db.GetTopPlayed(r.Context(), since, defaultPageSize)
+	if err != nil {
+		http.Error(w, "Failed to get stats", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(StatsResponse{Days: days, Top: top})
+}
+
+func handleVideoStats(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !isValidID(id) {
+		http.Error(w, getRandomErrorResponse(), http.StatusBadRequest)
+		return
+	}
+	since, ok := parseStatsSince(r)
+	if !ok {
+		http.Error(w, "invalid 'days' parameter", http.StatusBadRequest)
+		return
+	}
+	days, err := db.GetVideoDailyStats(r.Context(), id, since)
+	if err != nil {
+		http.Error(w, "Failed to get stats", http.StatusInternalServerError)
+		return
+	}
+	response := VideoStatsResponse{ID: id, Days: days}
+	for _, day := range days {
+		response.Total.Impressions += day.Impressions
+		response.Total.Plays += day.Plays
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"go3/db"
+	"net/http"
+)
+
+type SubmitterListResponse struct {
+	Submitters []db.Submitter `json:"submitters"`
+	Offset     int            `json:"offset"`
+}
+
+// submitters are only ever shown by their hashed identity, never by IP
+func handleSubmitterList(w http.ResponseWriter, r *http.Request) {
+	sort := r.URL.Query().Get("sort")
+	if sort == "" {
+		sort = db.SubmitterSortVideos
+	}
+	if sort != db.SubmitterSortVideos && sort != db.SubmitterSortVotes {
+		http.Error(w, "'sort' must be one of videos, votes", http.StatusBadRequest)
+		return
+	}
+	limit, offset, err := parseLimitOffset(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	submitters, err := db.ListSubmitters(r.Context(), sort, limit, offset)
+	if err != nil {
+		http.Error(w, "Failed to list submitters", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SubmitterListResponse{Submitters: submitters, Offset: offset})
+}
+
+func handleSubmitterVideos(w http.ResponseWriter, r *http.Request) {
+	q, err := parseListQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		logReject(r, err.Error(), "query", r.URL.RawQuery)
+		return
+	}
+	q.Submitter = r.PathValue("id")
+
+	page, err := db.ListVideos(r.Context(), q)
+	if err != nil {
+		http.Error(w, "Failed to list videos", http.StatusInternalServerError)
+		return
+	}
+	writeVideoPage(w, q, page)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go3/db"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// fields a refresh may change
+const (
+	fieldTitle      = "title"
+	fieldAuthor     = "author"
+	fieldEmbeddable = "embeddable"
+	fieldChannel    = "channel"
+)
+
+var refreshFields = []string{fieldTitle, fieldAuthor, fieldEmbeddable, fieldChannel}
+
+type updateOptions struct {
+	DryRun bool
+	Fields map[string]bool
+}
+
+// reads --dry-run and --fields, every field may change when --fields is not given
+func parseUpdateOptions(args config) (updateOptions, error) {
+	opts := updateOptions{DryRun: args.DryRun, Fields: make(map[string]bool)}
+	if args.Fields == "" {
+		for _, field := range refreshFields {
+			opts.Fields[field] = true
+		}
+		return opts, nil
+	}
+	for _, field := range strings.Split(args.Fields, ",") {
+		field = strings.TrimSpace(field)
+		switch field {
+		case fieldTitle, fieldAuthor, fieldEmbeddable, fieldChannel:
+			opts.Fields[field] = true
+		default:
+			return opts, fmt.Errorf("unknown field '%s' in --fields, use %s", field, strings.Join(refreshFields, ","))
+		}
+	}
+	return opts, nil
+}
+
+type fieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+type videoDiff struct {
+	ID      string        `json:"id"`
+	Changes []fieldChange `json:"changes"`
+	Skipped []fieldChange `json:"skipped,omitempty"`
+	Saved   bool          `json:"saved"`
+	// why saving the changes failed
+	Error string `json:"error,omitempty"`
+}
+
+// copies the allowed fields of fresh onto saved, everything else keeps its saved value
+// a new channel brings its own name along, the name belongs to the channel:
+// it is applied with the channel and never without it, that would rename the old channel
+func applyRefresh(saved db.Video, fresh db.Video, fields map[string]bool) (db.Video, videoDiff) {
+	diff := videoDiff{ID: saved.ID}
+	updated := saved
+	change := func(field string, allowed bool, old string, new string, apply func()) {
+		if old == new {
+			return
+		}
+		c := fieldChange{Field: field, Old: old, New: new}
+		if !allowed {
+			diff.Skipped = append(diff.Skipped, c)
+			return
+		}
+		diff.Changes = append(diff.Changes, c)
+		apply()
+	}
+
+	authorAllowed := fields[fieldAuthor]
+	if saved.ChannelID != fresh.ChannelID {
+		authorAllowed = fields[fieldChannel]
+	}
+	change(fieldTitle, fields[fieldTitle], saved.VideoName, fresh.VideoName, func() { updated.VideoName = fresh.VideoName })
+	change(fieldAuthor, authorAllowed, saved.VideoAuthorName, fresh.VideoAuthorName, func() { updated.VideoAuthorName = fresh.VideoAuthorName })
+	change(fieldEmbeddable, fields[fieldEmbeddable], strconv.FormatBool(saved.IsEmbeddable), strconv.FormatBool(fresh.IsEmbeddable), func() { updated.IsEmbeddable = fresh.IsEmbeddable })
+	change(fieldChannel, fields[fieldChannel], saved.ChannelID, fresh.ChannelID, func() { updated.ChannelID = fresh.ChannelID })
+	return updated, diff
+}
+
+// refreshes the given videos from YouTube, every saved video when ids is empty
+// returns what changed, or would have with opts.DryRun
+func updateVideos(ctx context.Context, ids []string, opts updateOptions, audit db.Audit) []videoDiff {
+	var videos []db.Video
+	if len(ids) == 0 {
+		all, err := db.GetAllVideos(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "error getting videos", "err", err)
+			return nil
+		}
+		videos = all
+	}
+	for _, id := range ids {
+		video, err := db.GetVideo(ctx, id)
+		if err != nil {
+			slog.InfoContext(ctx, "not found", "id", id)
+			continue
+		}
+		videos = append(videos, video)
+	}
+
+	diffs := []videoDiff{}
+	for _, video := range videos {
+		ytResp, err := fetchYTVideoInfo(ctx, video.ID)
+		if err != nil {
+			slog.ErrorContext(ctx, "error fetching video info", "err", err)
+			continue
+		}
+		updated, diff := applyRefresh(video, assembleVideo(ytResp, "", video.ID), opts.Fields)
+		if len(diff.Changes) > 0 && !opts.DryRun {
+			if err := db.UpdateVideo(ctx, updated, audit); err != nil {
+				slog.ErrorContext(ctx, "error updating video", "err", err)
+				diff.Error = err.Error()
+			} else {
+				diff.Saved = true
+			}
+		}
+		if len(diff.Changes) > 0 || len(diff.Skipped) > 0 {
+			diffs = append(diffs, diff)
+		}
+	}
+	slog.InfoContext(ctx, "checked videos", "count", len(videos), "changed", len(diffs))
+	return diffs
+}
+
+func printDiffs(diffs []videoDiff, output string) {
+	if output == outputJSON {
+		printJSON(diffs)
+		return
+	}
+	for _, diff := range diffs {
+		state := "would change"
+		if diff.Saved {
+			state = "updated"
+		} else if diff.Error != "" {
+			state = "failed: " + diff.Error
+		} else if len(diff.Changes) == 0 {
+			state = "unchanged"
+		}
+		fmt.Printf("%s: %s\n", diff.ID, state)
+		for _, c := range diff.Changes {
+			fmt.Printf("  %-10s %q -> %q\n", c.Field, c.Old, c.New)
+		}
+		for _, c := range diff.Skipped {
+			fmt.Printf("  %-10s %q -> %q (not in --fields)\n", c.Field, c.Old, c.New)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"go3/db"
+	"reflect"
+	"testing"
+)
+
+func TestApplyRefresh(t *testing.T) {
+	saved := db.Video{ID: "vid00000001", VideoName: "old title", VideoAuthorName: "old author", IsEmbeddable: true, ChannelID: "UCold", Status: db.StatusActive, Submitter: "ip:abc"}
+	all := map[string]bool{fieldTitle: true, fieldAuthor: true, fieldEmbeddable: true, fieldChannel: true}
+	tests := []struct {
+		name        string
+		fresh       db.Video
+		fields      map[string]bool
+		wantVideo   db.Video
+		wantChanges []fieldChange
+		wantSkipped []fieldChange
+	}{
+		{
+			name:      "nothing changed",
+			fresh:     saved,
+			fields:    all,
+			wantVideo: saved,
+		},
+		{
+			name:        "title and embeddability",
+			fresh:       db.Video{VideoName: "new title", VideoAuthorName: "old author", IsEmbeddable: false, ChannelID: "UCold"},
+			fields:      all,
+			wantVideo:   db.Video{ID: "vid00000001", VideoName: "new title", VideoAuthorName: "old author", IsEmbeddable: false, ChannelID: "UCold", Status: db.StatusActive, Submitter: "ip:abc"},
+			wantChanges: []fieldChange{{fieldTitle, "old title", "new title"}, {fieldEmbeddable, "true", "false"}},
+		},
+		{
+			name:        "fields not allowed are skipped",
+			fresh:       db.Video{VideoName: "new title", VideoAuthorName: "new author", IsEmbeddable: true, ChannelID: "UCold"},
+			fields:      map[string]bool{fieldAuthor: true},
+			wantVideo:   db.Video{ID: "vid00000001", VideoName: "old title", VideoAuthorName: "new author", IsEmbeddable: true, ChannelID: "UCold", Status: db.StatusActive, Submitter: "ip:abc"},
+			wantChanges: []fieldChange{{fieldAuthor, "old author", "new author"}},
+			wantSkipped: []fieldChange{{fieldTitle, "old title", "new title"}},
+		},
+		{
+			name:        "a new channel brings its name",
+			fresh:       db.Video{VideoName: "old title", VideoAuthorName: "new author", IsEmbeddable: true, ChannelID: "UCnew"},
+			fields:      map[string]bool{fieldChannel: true},
+			wantVideo:   db.Video{ID: "vid00000001", VideoName: "old title", VideoAuthorName: "new author", IsEmbeddable: true, ChannelID: "UCnew", Status: db.StatusActive, Submitter: "ip:abc"},
+			wantChanges: []fieldChange{{fieldAuthor, "old author", "new author"}, {fieldChannel, "UCold", "UCnew"}},
+		},
+		{
+			name:        "author alone doesn't follow a new channel",
+			fresh:       db.Video{VideoName: "old title", VideoAuthorName: "new author", IsEmbeddable: true, ChannelID: "UCnew"},
+			fields:      map[string]bool{fieldAuthor: true},
+			wantVideo:   saved,
+			wantSkipped: []fieldChange{{fieldAuthor, "old author", "new author"}, {fieldChannel, "UCold", "UCnew"}},
+		},
+		{
+			name:        "channel not allowed keeps the name",
+			fresh:       db.Video{VideoName: "old title", VideoAuthorName: "new author", IsEmbeddable: true, ChannelID: "UCnew"},
+			fields:      map[string]bool{fieldTitle: true},
+			wantVideo:   saved,
+			wantSkipped: []fieldChange{{fieldAuthor, "old author", "new author"}, {fieldChannel, "UCold", "UCnew"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			video, diff := applyRefresh(saved, tt.fresh, tt.fields)
+			if video != tt.wantVideo {
+				t.Errorf("video = %+v, want %+v", video, tt.wantVideo)
+			}
+			if diff.ID != saved.ID {
+				t.Errorf("diff.ID = %q, want %q", diff.ID, saved.ID)
+			}
+			if !reflect.DeepEqual(diff.Changes, tt.wantChanges) {
+				t.Errorf("changes = %v, want %v", diff.Changes, tt.wantChanges)
+			}
+			if !reflect.DeepEqual(diff.Skipped, tt.wantSkipped) {
+				t.Errorf("skipped = %v, want %v", diff.Skipped, tt.wantSkipped)
+			}
+		})
+	}
+}
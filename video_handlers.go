@@ -0,0 +1,335 @@
+package main
+
+import (
+	"crypto/sha1"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go3/db"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+type VideoDetailResponse struct {
+	ID              string        `json:"id"`
+	VideoName       string        `json:"video_name"`
+	VideoAuthorName string        `json:"video_author_name"`
+	ChannelID       string        `json:"channel_id"`
+	IsEmbeddable    bool          `json:"is_embeddable"`
+	AddedAt         int64         `json:"added_at"`
+	LogoURL         string        `json:"logo_url"`
+	Status          string        `json:"status"`
+	Submitter       string        `json:"submitter,omitempty"`
+	Votes           *db.VoteScore `json:"votes,omitempty"`
+}
+
+type VideoListResponse struct {
+	Videos     []VideoDetailResponse `json:"videos"`
+	NextCursor string                `json:"next_cursor,omitempty"`
+}
+
+// cursor handed out to clients, tied to the sort it was created with
+type listCursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d"`
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+func newVideoDetailResponse(video db.Video, logo string) VideoDetailResponse {
+	return VideoDetailResponse{
+		ID:              video.ID,
+		VideoName:       video.VideoName,
+		VideoAuthorName: video.VideoAuthorName,
+		ChannelID:       video.ChannelID,
+		IsEmbeddable:    video.IsEmbeddable,
+		AddedAt:         video.AddedAt,
+		LogoURL:         logo,
+		Status:          video.Status,
+		Submitter:       video.Submitter,
+	}
+}
+
+func encodeCursor(c listCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(raw string) (listCursor, error) {
+	var c listCursor
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(data, &c)
+	return c, err
+}
+
+// reads the limit/offset pair used by the offset paginated endpoints
+func parseLimitOffset(r *http.Request) (int, int, error) {
+	params := r.URL.Query()
+	limit := defaultPageSize
+	if raw := params.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			return 0, 0, errors.New("invalid 'limit' parameter")
+		}
+		limit = min(n, maxPageSize)
+	}
+	offset := 0
+	if raw := params.Get("offset"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return 0, 0, errors.New("invalid 'offset' parameter")
+		}
+		offset = n
+	}
+	return limit, offset, nil
+}
+
+// reads limit/sort/order/cursor and the filters shared by the listing endpoints
+func parseListQuery(r *http.Request) (db.ListQuery, error) {
+	params := r.URL.Query()
+	q := db.ListQuery{Sort: db.SortAddedAt, Limit: defaultPageSize}
+
+	if raw := params.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			return q, errors.New("invalid 'limit' parameter")
+		}
+		q.Limit = min(limit, maxPageSize)
+	}
+	if sort := params.Get("sort"); sort != "" {
+		if !db.IsValidSort(sort) {
+			return q, errors.New("invalid 'sort' parameter")
+		}
+		q.Sort = sort
+	}
+	switch params.Get("order") {
+	case "", "asc":
+	case "desc":
+		q.Desc = true
+	default:
+		return q, errors.New("invalid 'order' parameter")
+	}
+
+	q.ChannelID = params.Get("channel_id")
+	if raw := params.Get("embeddable"); raw != "" {
+		embeddable, err := strconv.ParseBool(raw)
+		if err != nil {
+			return q, errors.New("invalid 'embeddable' parameter")
+		}
+		q.Embeddable = &embeddable
+	}
+	if raw := params.Get("added_after"); raw != "" {
+		t, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return q, errors.New("invalid 'added_after' parameter")
+		}
+		q.AddedAfter = t
+	}
+	if raw := params.Get("added_before"); raw != "" {
+		t, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return q, errors.New("invalid 'added_before' parameter")
+		}
+		q.AddedBefore = t
+	}
+
+	if raw := params.Get("cursor"); raw != "" {
+		c, err := decodeCursor(raw)
+		if err != nil || c.ID == "" {
+			return q, errors.New("invalid 'cursor' parameter")
+		}
+		if c.Sort != q.Sort || c.Desc != q.Desc {
+			return q, errors.New("'cursor' does not match 'sort'/'order'")
+		}
+		if _, err := db.ParseSortValue(c.Sort, c.Value); err != nil {
+			return q, errors.New("invalid 'cursor' parameter")
+		}
+		q.AfterValue = c.Value
+		q.AfterID = c.ID
+	}
+	return q, nil
+}
+
+// writes a page of videos, next_cursor is empty on the last page
+func writeVideoPage(w http.ResponseWriter, q db.ListQuery, page db.VideoPage) {
+	response := VideoListResponse{Videos: make([]VideoDetailResponse, 0, len(page.Videos))}
+	for _, video := range page.Videos {
+		response.Videos = append(response.Videos, newVideoDetailResponse(video, ""))
+	}
+	if page.More {
+		last := page.Videos[len(page.Videos)-1]
+		response.NextCursor = encodeCursor(listCursor{
+			Sort:  q.Sort,
+			Desc:  q.Desc,
+			Value: q.SortValue(last),
+			ID:    last.ID,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func handleVideoList(w http.ResponseWriter, r *http.Request) {
+	q, err := parseListQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		logReject(r, err.Error(), "query", r.URL.RawQuery)
+		return
+	}
+
+	page, err := db.ListVideos(r.Context(), q)
+	if err != nil {
+		http.Error(w, "Failed to list videos", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "error listing videos", "err", err)
+		return
+	}
+	writeVideoPage(w, q, page)
+}
+
+// ETag of the stored record and its votes, the logo is derived from the channel so it is left out
+func videoETag(video db.Video, votes db.VoteScore) string {
+	sum := sha1.Sum(fmt.Appendf(nil, "%s|%s|%s|%s|%t|%d|%s|%s|%d|%d|%d",
+		video.ID,
+		video.VideoName,
+		video.VideoAuthorName,
+		video.ChannelID,
+		video.IsEmbeddable,
+		video.AddedAt,
+		video.Status,
+		video.Submitter,
+		video.UpdatedAt,
+		votes.Likes,
+		votes.Dislikes,
+	))
+	return fmt.Sprintf(`"%x"`, sum[:8])
+}
+
+// reports whether the client already has this version of the resource
+// If-None-Match wins over If-Modified-Since, same as net/http
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == etag || tag == "*" {
+				return true
+			}
+		}
+		return false
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		t, err := http.ParseTime(ims)
+		if err != nil {
+			return false
+		}
+		return !modified.Truncate(time.Second).After(t)
+	}
+	return false
+}
+
+func handleVideoHead(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !isValidID(id) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	exists, err := db.IsVideoSaved(r.Context(), id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "error checking if video exists", "err", err)
+		return
+	}
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func handleVideoGet(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !isValidID(id) {
+		http.Error(w, getRandomErrorResponse(), http.StatusBadRequest)
+		logReject(r, "invalid 'id'", "id", id)
+		return
+	}
+
+	video, err := db.GetVideo(r.Context(), id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Video not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to get video", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "error getting video", "err", err)
+		return
+	}
+
+	votes := videoVotes(r.Context(), video.ID)
+	etag := videoETag(video, votes)
+	modified := time.Unix(max(video.UpdatedAt, votes.LastVotedAt), 0).UTC()
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+	if notModified(r, etag, modified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	logo := channelLogo(r.Context(), video.ChannelID)
+
+	w.Header().Set("Content-Type", "application/json")
+	response := newVideoDetailResponse(video, logo)
+	response.Votes = &votes
+	json.NewEncoder(w).Encode(response)
+	slog.InfoContext(r.Context(), "requested video", "id", video.ID)
+}
+
+type VideoHistoryResponse struct {
+	ID        string        `json:"id"`
+	Revisions []db.Revision `json:"revisions"`
+	Offset    int           `json:"offset"`
+}
+
+// metadata changes of a video newest first
+func handleVideoHistory(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !isValidID(id) {
+		http.Error(w, getRandomErrorResponse(), http.StatusBadRequest)
+		logReject(r, "invalid 'id'", "id", id)
+		return
+	}
+	limit, offset, err := parseLimitOffset(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	exists, err := db.IsVideoSaved(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Failed to check if video exists", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Video not found", http.StatusNotFound)
+		return
+	}
+	revisions, err := db.GetRevisions(r.Context(), id, limit, offset)
+	if err != nil {
+		http.Error(w, "Failed to get video history", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(VideoHistoryResponse{ID: id, Revisions: revisions, Offset: offset})
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"go3/db"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// windows accepted by /v2/top, 0 means all time
+var topWindows = map[string]time.Duration{
+	"day":   24 * time.Hour,
+	"week":  7 * 24 * time.Hour,
+	"month": 30 * 24 * time.Hour,
+	"year":  365 * 24 * time.Hour,
+	"all":   0,
+}
+
+var voteValues = map[string]int{
+	"up":    1,
+	"down":  -1,
+	"clear": 0,
+}
+
+type VoteResponse struct {
+	ID       string       `json:"id"`
+	Votes    db.VoteScore `json:"votes"`
+	YourVote int          `json:"your_vote"`
+}
+
+type TopResponse struct {
+	Window string                `json:"window"`
+	Videos []VideoDetailResponse `json:"videos"`
+}
+
+// votes of the video for responses, a failed lookup only costs the counts
+func videoVotes(ctx context.Context, id string) db.VoteScore {
+	score, err := db.GetVoteScore(ctx, id)
+	if err != nil {
+		slog.ErrorContext(ctx, "error getting votes", "err", err)
+	}
+	return score
+}
+
+func handleVote(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !isValidID(id) {
+		http.Error(w, getRandomErrorResponse(), http.StatusBadRequest)
+		logReject(r, "invalid 'id'", "id", id)
+		return
+	}
+	value, ok := voteValues[r.URL.Query().Get("value")]
+	if !ok {
+		http.Error(w, "'value' must be one of up, down, clear", http.StatusBadRequest)
+		return
+	}
+
+	exists, err := db.IsVideoSaved(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Failed to check if video exists", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "error checking if video exists", "err", err)
+		return
+	}
+	if !exists {
+		http.Error(w, "Video not found", http.StatusNotFound)
+		return
+	}
+
+	audit := requestAudit(r)
+	voter := audit.Actor
+	if err := db.SetVote(r.Context(), id, voter, value, audit); err != nil {
+		http.Error(w, "Failed to save vote", http.StatusInternalServerError)
+		return
+	}
+	score, err := db.GetVoteScore(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Failed to get votes", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(VoteResponse{ID: id, Votes: score, YourVote: value})
+	slog.InfoContext(r.Context(), "vote", "id", id, "value", value, "voter", voter)
+}
+
+func handleTop(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	window := params.Get("window")
+	if window == "" {
+		window = "week"
+	}
+	span, ok := topWindows[window]
+	if !ok {
+		http.Error(w, "'window' must be one of day, week, month, year, all", http.StatusBadRequest)
+		return
+	}
+	limit := defaultPageSize
+	if raw := params.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			http.Error(w, "invalid 'limit' parameter", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxPageSize)
+	}
+
+	var since int64
+	if span > 0 {
+		since = time.Now().Add(-span).Unix()
+	}
+	videos, err := db.TopVideos(r.Context(), since, limit)
+	if err != nil {
+		http.Error(w, "Failed to get top videos", http.StatusInternalServerError)
+		return
+	}
+
+	response := TopResponse{Window: window, Videos: make([]VideoDetailResponse, 0, len(videos))}
+	for _, rated := range videos {
+		detail := newVideoDetailResponse(rated.Video, "")
+		detail.Votes = &rated.Votes
+		response.Videos = append(response.Videos, detail)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go3/env"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// videos.list and channels.list cost one unit each
+const ytCallCost = 1
+
+// quota resets at midnight Pacific time, UTC-8 is close enough when the tz database is missing
+var ytQuotaZone = func() *time.Location {
+	loc, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		return time.FixedZone("PST", -8*60*60)
+	}
+	return loc
+}()
+
+// ytQuotaTracker counts the YouTube Data API units spent today,
+// the API saying quotaExceeded marks the day as exhausted whatever the count says
+type ytQuotaTracker struct {
+	mu        sync.Mutex
+	day       string
+	used      int
+	exhausted bool
+}
+
+var ytQuota = &ytQuotaTracker{}
+
+func ytDailyQuota() int {
+	return env.YTDailyQuota.Int(10000)
+}
+
+// starts a new count when the quota day changed, callers hold mu
+func (q *ytQuotaTracker) roll() {
+	day := time.Now().In(ytQuotaZone).Format("2006-01-02")
+	if day != q.day {
+		q.day = day
+		q.used = 0
+		q.exhausted = false
+	}
+}
+
+func (q *ytQuotaTracker) Use(units int) {
+	q.mu.Lock()
+	q.roll()
+	q.used += units
+	q.mu.Unlock()
+}
+
+func (q *ytQuotaTracker) MarkExhausted() {
+	q.mu.Lock()
+	q.roll()
+	q.exhausted = true
+	q.mu.Unlock()
+}
+
+// units used today, the daily limit and whether it ran out
+func (q *ytQuotaTracker) State() (int, int, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.roll()
+	limit := ytDailyQuota()
+	return q.used, limit, q.exhausted || q.used >= limit
+}
+
+// calls the YouTube Data API endpoint (videos, channels) and decodes the answer into dest
+// non-200 answers are errors, a quotaExceeded one marks the quota as exhausted
+func ytGet(ctx context.Context, endpoint string, url string, dest any) (err error) {
+	ytQuota.Use(ytCallCost)
+	ytQuotaUnits.Add(ytCallCost, endpoint)
+	start := time.Now()
+	defer func() {
+		ytDuration.Since(start, endpoint)
+		result := "ok"
+		if err != nil {
+			result = "error"
+		}
+		ytCalls.Inc(endpoint, result)
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if resp.StatusCode == http.StatusForbidden && strings.Contains(string(body), "quotaExceeded") {
+			ytQuota.MarkExhausted()
+			slog.WarnContext(ctx, "daily quota exceeded", "component", "youtube")
+		}
+		return fmt.Errorf("youtube: %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(dest)
+}